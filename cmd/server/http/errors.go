@@ -0,0 +1,116 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/zkhrg/go_day03/internal/logging"
+	"github.com/zkhrg/go_day03/internal/places"
+)
+
+// Problem ответ с ошибкой в формате RFC 7807
+type Problem struct {
+	// URI вида ошибки относительно адреса сервиса
+	Type   string `json:"type" example:"/problems/invalid-parameter"`
+	Title  string `json:"title" example:"Invalid parameter"`
+	Status int    `json:"status" example:"400"`
+	Detail string `json:"detail,omitempty" example:"'page' must be a positive integer"`
+	// путь запроса, на который пришла ошибка
+	Instance string `json:"instance,omitempty" example:"/api/places/"`
+	// параметр запроса или поле тела, из-за которого запрос отклонен
+	Param     string `json:"param,omitempty" example:"page"`
+	RequestID string `json:"request_id,omitempty" example:"6096581bd4e17cee8739908a0a848912"`
+}
+
+const problemContentType = "application/problem+json"
+
+// problemKind вид ошибки: по нему клиент решает, что делать, а detail
+// объясняет конкретный случай
+type problemKind struct {
+	slug   string
+	title  string
+	status int
+	param  string
+}
+
+var (
+	problemInvalidParameter  = problemKind{slug: "invalid-parameter", title: "Invalid parameter", status: http.StatusBadRequest}
+	problemInvalidBody       = problemKind{slug: "invalid-body", title: "Invalid request body", status: http.StatusBadRequest}
+	problemInvalidQuery      = problemKind{slug: "invalid-query", title: "Query rejected by storage", status: http.StatusBadRequest}
+	problemUnauthorized      = problemKind{slug: "unauthorized", title: "Authentication required", status: http.StatusUnauthorized}
+	problemInvalidToken      = problemKind{slug: "invalid-token", title: "Invalid credentials or token", status: http.StatusUnauthorized}
+	problemInsufficientScope = problemKind{slug: "insufficient-scope", title: "Insufficient scope", status: http.StatusForbidden}
+	problemNotFound          = problemKind{slug: "not-found", title: "Not found", status: http.StatusNotFound}
+	problemMethodNotAllowed  = problemKind{slug: "method-not-allowed", title: "Method not allowed", status: http.StatusMethodNotAllowed}
+	problemConflict          = problemKind{slug: "conflict", title: "Conflict", status: http.StatusConflict}
+	problemRateLimited       = problemKind{slug: "rate-limited", title: "Too many requests", status: http.StatusTooManyRequests}
+	problemQuotaExceeded     = problemKind{slug: "quota-exceeded", title: "Quota exceeded", status: http.StatusTooManyRequests}
+	problemInternal          = problemKind{slug: "internal", title: "Internal server error", status: http.StatusInternalServerError}
+	problemUnavailable       = problemKind{slug: "unavailable", title: "Storage unavailable", status: http.StatusServiceUnavailable}
+	problemNotReady          = problemKind{slug: "not-ready", title: "Service is not ready", status: http.StatusServiceUnavailable}
+	problemDeadlineExceeded  = problemKind{slug: "deadline-exceeded", title: "Request deadline exceeded", status: http.StatusServiceUnavailable}
+	problemUpstreamTimeout   = problemKind{slug: "upstream-timeout", title: "Storage timeout", status: http.StatusGatewayTimeout}
+)
+
+// about ошибка вида k из-за параметра или поля тела param
+func (k problemKind) about(param string) problemKind {
+	k.param = param
+	return k
+}
+
+// writeProblem отвечает ошибкой вида kind. Все ошибки HTTP слоя проходят
+// через нее, кроме ответов OAuth token endpoint, формат которых задан RFC 6749
+func writeProblem(w http.ResponseWriter, r *http.Request, kind problemKind, detail string) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(kind.status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:      "/problems/" + kind.slug,
+		Title:     kind.title,
+		Status:    kind.status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Param:     kind.param,
+		RequestID: logging.RequestID(r.Context()),
+	})
+}
+
+// statusClientClosedRequest клиент закрыл соединение, не дождавшись
+// ответа. Код из nginx, нужен только логам и метрикам
+const statusClientClosedRequest = 499
+
+// writeStoreError отвечает на ошибку стора. Коды по виду ошибки:
+// неверный запрос - 400, нет индекса или документа - 404, эластик недоступен -
+// 503, эластик не ответил за свой таймаут - 504, закончилось время всего
+// запроса - 503. На 503 клиент может повторить запрос позже. msg - текст
+// ответа для остальных ошибок
+func writeStoreError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	var timeout *places.TimeoutError
+	switch {
+	case errors.As(err, &timeout) && timeout.RequestDeadline:
+		slog.WarnContext(r.Context(), "request deadline exceeded", "err", err)
+		w.Header().Set("Retry-After", "1")
+		writeProblem(w, r, problemDeadlineExceeded, "Request took too long, try again later")
+	case errors.As(err, &timeout):
+		slog.WarnContext(r.Context(), "elasticsearch timeout", "err", err)
+		writeProblem(w, r, problemUpstreamTimeout, "Elasticsearch did not respond in time")
+	case errors.Is(err, context.Canceled):
+		w.WriteHeader(statusClientClosedRequest)
+	case errors.Is(err, places.ErrBadQuery):
+		slog.WarnContext(r.Context(), "bad store query", "err", err)
+		writeProblem(w, r, problemInvalidQuery, "Invalid query parameters")
+	case errors.Is(err, places.ErrNotFound):
+		slog.WarnContext(r.Context(), "places index or document not found", "err", err)
+		writeProblem(w, r, problemNotFound, "Places index not found")
+	case errors.Is(err, places.ErrUnavailable):
+		slog.ErrorContext(r.Context(), "elasticsearch is unavailable", "err", err)
+		w.Header().Set("Retry-After", "5")
+		writeProblem(w, r, problemUnavailable, "Elasticsearch is unavailable, try again later")
+	default:
+		slog.ErrorContext(r.Context(), msg, "err", err)
+		writeProblem(w, r, problemInternal, msg)
+	}
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/places"
+)
+
+// decodeProblem проверяет заголовки ответа с ошибкой и разбирает его тело
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != problemContentType {
+		t.Fatalf("Content-Type = %q, want %q", ct, problemContentType)
+	}
+	var p Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	if p.Status != rec.Code {
+		t.Errorf("problem status = %d, response status = %d", p.Status, rec.Code)
+	}
+	return p
+}
+
+func TestWriteStoreError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantType   string // пусто - ответ без тела
+		wantRetry  string
+	}{
+		{
+			name:       "bad query",
+			err:        &places.StoreError{Op: "search", Kind: places.ErrBadQuery, Status: http.StatusBadRequest},
+			wantStatus: http.StatusBadRequest,
+			wantType:   "/problems/invalid-query",
+		},
+		{
+			name:       "index not found",
+			err:        &places.StoreError{Op: "search", Kind: places.ErrNotFound, Status: http.StatusNotFound},
+			wantStatus: http.StatusNotFound,
+			wantType:   "/problems/not-found",
+		},
+		{
+			name:       "client closed request",
+			err:        fmt.Errorf("search: %w", context.Canceled),
+			wantStatus: statusClientClosedRequest,
+		},
+		{
+			name:       "elasticsearch unavailable",
+			err:        &places.StoreError{Op: "search", Kind: places.ErrUnavailable, Err: errors.New("connection refused")},
+			wantStatus: http.StatusServiceUnavailable,
+			wantType:   "/problems/unavailable",
+			wantRetry:  "5",
+		},
+		{
+			name:       "request deadline",
+			err:        &places.TimeoutError{Op: "search", RequestDeadline: true, Err: context.DeadlineExceeded},
+			wantStatus: http.StatusServiceUnavailable,
+			wantType:   "/problems/deadline-exceeded",
+			wantRetry:  "1",
+		},
+		{
+			name:       "elasticsearch timeout",
+			err:        &places.TimeoutError{Op: "search", Timeout: time.Second, Err: context.DeadlineExceeded},
+			wantStatus: http.StatusGatewayTimeout,
+			wantType:   "/problems/upstream-timeout",
+		},
+		{
+			name:       "other error",
+			err:        errors.New("boom"),
+			wantStatus: http.StatusInternalServerError,
+			wantType:   "/problems/internal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeStoreError(rec, httptest.NewRequest(http.MethodGet, "/api/places/", nil), "Failed to get page", tt.err)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetry {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetry)
+			}
+			if tt.wantType == "" {
+				if rec.Body.Len() != 0 {
+					t.Errorf("body = %q, want empty", rec.Body.String())
+				}
+				return
+			}
+			p := decodeProblem(t, rec)
+			if p.Type != tt.wantType {
+				t.Errorf("type = %q, want %q", p.Type, tt.wantType)
+			}
+			if p.Instance != "/api/places/" {
+				t.Errorf("instance = %q, want /api/places/", p.Instance)
+			}
+		})
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeProblem(rec, httptest.NewRequest(http.MethodGet, "/api/places/?page=0", nil),
+		problemInvalidParameter.about("page"), "'page' parameter must be a positive integer")
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+	want := Problem{
+		Type:     "/problems/invalid-parameter",
+		Title:    "Invalid parameter",
+		Status:   http.StatusBadRequest,
+		Detail:   "'page' parameter must be a positive integer",
+		Instance: "/api/places/",
+		Param:    "page",
+	}
+	if got := decodeProblem(t, rec); got != want {
+		t.Errorf("problem = %+v, want %+v", got, want)
+	}
+}
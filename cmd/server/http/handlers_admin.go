@@ -0,0 +1,107 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/zkhrg/go_day03/internal/api"
+	"github.com/zkhrg/go_day03/internal/places"
+)
+
+const maxDatasetUploadSize = 64 << 20
+
+// @Summary Upload a places dataset
+// @Description Upload a tab separated places file and index it in background job. Only one import runs at a time, finished jobs are kept for 24 hours. Uploads are rejected until the startup import finishes. Requires admin scope
+// @Tags admin
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Places dataset (tsv with ID, Name, Address, Phone, Longitude, Latitude columns)"
+// @Param region formData string false "Name of configured region to check coordinates against"
+// @Success 202 {object} api.ImportJob
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 405 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Failure 503 {object} Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /admin/datasets [post]
+func UploadDatasetHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// загрузку при старте видно сразу, файл можно не принимать
+		if !a.IndexLoaded() {
+			writeNotReady(w, r)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxDatasetUploadSize)
+		// файл целиком пишется на диск, а не держится в памяти
+		if err := r.ParseMultipartForm(0); err != nil {
+			writeProblem(w, r, problemInvalidBody.about("file"), "Missing 'file' form field or file is too large")
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			writeProblem(w, r, problemInvalidBody.about("file"), "Missing 'file' form field or file is too large")
+			return
+		}
+		defer file.Close()
+
+		job, err := a.ImportDataset(r.Context(), file, places.ImportOptions{Region: r.FormValue("region")})
+		if errors.Is(err, api.ErrNotReady) {
+			writeNotReady(w, r)
+			return
+		}
+		if errors.Is(err, api.ErrImportRunning) {
+			w.Header().Set("Location", "/admin/jobs/"+job.ID)
+			writeProblem(w, r, problemConflict, "Import job "+job.ID+" is still running, try again after it finishes")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "can not start import job", "err", err)
+			writeProblem(w, r, problemInternal, "Failed to start import")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/admin/jobs/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// writeNotReady отвечает на загрузку датасета, пока идет загрузка при старте
+func writeNotReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "30")
+	writeProblem(w, r, problemNotReady, "Dataset is still loading at startup, try again later")
+}
+
+// @Summary Get an import job
+// @Description Get progress and final report of dataset import job. Requires admin scope
+// @Tags admin
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} api.ImportJob
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 405 {object} Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /admin/jobs/{id} [get]
+func ImportJobHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := a.GetImportJob(r.PathValue("id"))
+		if !ok {
+			writeProblem(w, r, problemNotFound, "Job not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	}
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zkhrg/go_day03/internal/api"
+)
+
+func TestUploadDatasetNotReady(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "data.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("ID\tName\tAddress\tPhone\tLongitude\tLatitude\n"))
+	mw.Close()
+
+	// индекс еще загружается при старте
+	a := &api.API{}
+	r := httptest.NewRequest(http.MethodPost, "/admin/datasets", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	UploadDatasetHandler(a).ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if p := decodeProblem(t, rec); p.Type != "/problems/not-ready" {
+		t.Errorf("type = %q, want /problems/not-ready", p.Type)
+	}
+}
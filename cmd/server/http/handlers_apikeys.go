@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/api"
+	"github.com/zkhrg/go_day03/internal/auth"
+)
+
+// CreateAPIKeyRequest тело запроса на выпуск API ключа
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKey выпущенный ключ, поле key больше нигде не возвращается
+type CreatedAPIKey struct {
+	Key string `json:"key"`
+	auth.APIKey
+}
+
+// @Summary Create an API key
+// @Description Create a long-lived API key for machine clients. Without scopes the key gets places:read. Requires admin scope
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "Key name, scopes and optional expiry"
+// @Success 201 {object} CreatedAPIKey
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 405 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /admin/api-keys [post]
+func CreateAPIKeyHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateAPIKeyRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeProblem(w, r, problemInvalidBody, "Request body must be a json with 'name', 'scopes' and 'expires_at'")
+			return
+		}
+
+		principal, _ := PrincipalFromContext(r.Context())
+		key, secret, err := a.CreateAPIKey(req.Name, req.Scopes, req.ExpiresAt, principal.Username)
+		switch {
+		case errors.Is(err, auth.ErrInvalidKeyName):
+			writeProblem(w, r, problemInvalidBody.about("name"), err.Error())
+			return
+		case errors.Is(err, auth.ErrUnknownScope):
+			writeProblem(w, r, problemInvalidBody.about("scopes"), err.Error())
+			return
+		case errors.Is(err, auth.ErrExpiryInThePast):
+			writeProblem(w, r, problemInvalidBody.about("expires_at"), err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "error creating api key", "err", err)
+			writeProblem(w, r, problemInternal, "Failed to create API key")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(CreatedAPIKey{Key: secret, APIKey: key})
+	}
+}
+
+// @Summary List API keys
+// @Description List all API keys including revoked ones with their usage. Requires admin scope
+// @Tags admin
+// @Produce json
+// @Success 200 {array} auth.APIKey
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 405 {object} Problem
+// @Security BearerAuth
+// @Router /admin/api-keys [get]
+func ListAPIKeysHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.ListAPIKeys())
+	}
+}
+
+// @Summary Revoke an API key
+// @Description Revoke an API key, requests with it are rejected right away. Requires admin scope
+// @Tags admin
+// @Param id path string true "API key ID"
+// @Success 204
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /admin/api-keys/{id} [delete]
+func RevokeAPIKeyHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := a.RevokeAPIKey(r.PathValue("id"))
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
+			writeProblem(w, r, problemNotFound, "API key not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error revoking api key", "err", err)
+			writeProblem(w, r, problemInternal, "Failed to revoke API key")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
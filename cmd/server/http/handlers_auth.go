@@ -2,38 +2,164 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 
 	"github.com/zkhrg/go_day03/internal/api"
+	"github.com/zkhrg/go_day03/internal/auth"
 )
 
-// @title My API
-// @version 1.0
-// @description This is a sample server.
-// @BasePath /api
+// Credentials тело запросов регистрации и входа
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
 
-// @Summary Generete token by provided username
-// @Description Generete JWT token by provided username
+// @Summary Register a new user
+// @Description Register a new user with username and password
 // @Tags token
+// @Accept json
 // @Produce json
-// @Param username query string false "Username whos requesting a token"
-// @Success 200 {string} string
-// @Router /api/get_token/ [get]
-func generateTokenHandler(a *api.API) http.HandlerFunc {
+// @Param credentials body Credentials true "Username and password"
+// @Success 201 {object} map[string]string
+// @Failure 400 {object} Problem
+// @Failure 405 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /api/signup/ [post]
+func signUpHandler(a *api.API) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		username, err := a.GetTokenByName(r.Context().Value(UsernameContextKey).(string))
+		creds := r.Context().Value(CredentialsContextKey).(Credentials)
+		err := a.SignUp(r.Context(), creds.Username, creds.Password)
+		switch {
+		case errors.Is(err, auth.ErrInvalidUsername):
+			writeProblem(w, r, problemInvalidBody.about("username"), err.Error())
+			return
+		case errors.Is(err, auth.ErrWeakPassword), errors.Is(err, auth.ErrPasswordTooLong):
+			writeProblem(w, r, problemInvalidBody.about("password"), err.Error())
+			return
+		case errors.Is(err, auth.ErrUserExists):
+			writeProblem(w, r, problemConflict.about("username"), "User already exists")
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "error signing up user", "err", err)
+			writeProblem(w, r, problemInternal, "Failed to sign up")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"username": creds.Username})
+	}
+}
+
+// RefreshRequest тело запросов обновления и отзыва токенов
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// @Summary Log in and get a token
+// @Description Check username and password and generate short-lived JWT access token with refresh token
+// @Tags token
+// @Accept json
+// @Produce json
+// @Param credentials body Credentials true "Username and password"
+// @Success 200 {object} auth.TokenPair
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 405 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /api/login/ [post]
+func loginHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		creds := r.Context().Value(CredentialsContextKey).(Credentials)
+		pair, err := a.Login(r.Context(), creds.Username, creds.Password)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			writeProblem(w, r, problemInvalidToken, "Invalid username or password")
+			return
+		}
 		if err != nil {
-			http.Error(w, "Failed to get username", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "error generating token", "err", err)
+			writeProblem(w, r, problemInternal, "Error generating token")
 			return
 		}
 
-		token, err := a.GetTokenByName(username)
+		writeTokenPair(w, pair)
+	}
+}
+
+// @Summary Refresh a token
+// @Description Exchange refresh token for a new access and refresh token pair. Reusing a refresh token revokes the whole session
+// @Tags token
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest true "Refresh token"
+// @Success 200 {object} auth.TokenPair
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 405 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /api/token/refresh [post]
+func refreshTokenHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refreshToken := r.Context().Value(RefreshTokenContextKey).(string)
+		pair, err := a.RefreshToken(refreshToken)
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			writeProblem(w, r, problemInvalidToken.about("refresh_token"), err.Error())
+			return
+		}
 		if err != nil {
-			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "error refreshing token", "err", err)
+			writeProblem(w, r, problemInternal, "Error generating token")
 			return
 		}
 
+		writeTokenPair(w, pair)
+	}
+}
+
+// @Summary Revoke a token
+// @Description Log out: revoke refresh token with its whole session and access token from Authorization header if provided
+// @Tags token
+// @Accept json
+// @Param request body RefreshRequest true "Refresh token"
+// @Success 204
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 405 {object} Problem
+// @Security BearerAuth
+// @Router /api/token/revoke [post]
+func revokeTokenHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refreshToken := r.Context().Value(RefreshTokenContextKey).(string)
+		accessToken, _ := bearerToken(r)
+		if err := a.RevokeToken(refreshToken, accessToken); err != nil {
+			writeProblem(w, r, problemInvalidToken.about("refresh_token"), err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeTokenPair(w http.ResponseWriter, pair auth.TokenPair) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// @Summary Get public signing keys
+// @Description Get public keys of asymmetric token signing keys as JSON Web Key Set
+// @Tags token
+// @Produce json
+// @Success 200 {object} auth.JWKS
+// @Failure 405 {object} Problem
+// @Router /.well-known/jwks.json [get]
+func jwksHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"token": token})
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(a.JWKS())
 	}
 }
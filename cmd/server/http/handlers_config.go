@@ -0,0 +1,25 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/zkhrg/go_day03/internal/api"
+)
+
+// @Summary Get effective configuration
+// @Description Get settings the server runs with after merging config file, environment and flags. Secrets are replaced with [REDACTED]. Requires admin scope
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /admin/config [get]
+func ConfigHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Config)
+	}
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/api"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// HealthStatus ответ проверок живости и готовности
+type HealthStatus struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// @Summary Liveness probe
+// @Description Process is up and serving HTTP
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthStatus
+// @Router /healthz [get]
+func HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, HealthStatus{Status: "ok"})
+	}
+}
+
+// @Summary Readiness probe
+// @Description Elasticsearch is reachable and places index is loaded. Returns 503 while the index is loading or during shutdown
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthStatus
+// @Failure 503 {object} HealthStatus
+// @Router /readyz [get]
+func ReadyzHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := a.Readiness(ctx); err != nil {
+			writeHealth(w, http.StatusServiceUnavailable, HealthStatus{Status: "unavailable", Reason: err.Error()})
+			return
+		}
+		writeHealth(w, http.StatusOK, HealthStatus{Status: "ready"})
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status int, body HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,364 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zkhrg/go_day03/internal/api"
+	"github.com/zkhrg/go_day03/internal/auth"
+)
+
+// authorizePage данные формы входа на /oauth/authorize
+type authorizePage struct {
+	Client  auth.Client
+	Request auth.AuthorizationRequest
+	Scopes  []string
+	Error   string
+}
+
+// @Summary Authorization endpoint
+// @Description Show sign in form for OAuth2 authorization code flow. PKCE with S256 is required
+// @Tags oauth
+// @Produce html
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string false "Registered redirect URI, may be omitted if the client has only one"
+// @Param scope query string false "Space separated scopes"
+// @Param state query string false "Opaque value returned to the client"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /oauth/authorize [get]
+func AuthorizeFormHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := authorizationRequest(r.URL.Query())
+		// checked с подставленным redirect_uri по умолчанию нужен для
+		// редиректов, а форма передает дальше запрос как его прислал клиент
+		checked := req
+		client, err := a.CheckAuthorization(&checked)
+		if err != nil {
+			authorizeError(w, r, checked, err)
+			return
+		}
+		renderAuthorizeForm(w, r, http.StatusOK, client, req, "")
+	}
+}
+
+// @Summary Sign in and authorize a client
+// @Description Check user credentials from the sign in form and redirect back to the client with authorization code
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param username formData string true "Username"
+// @Param password formData string true "Password"
+// @Param action formData string false "allow or deny"
+// @Success 302
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /oauth/authorize [post]
+func AuthorizeHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		if err := r.ParseForm(); err != nil {
+			writeProblem(w, r, problemInvalidBody, "Invalid form")
+			return
+		}
+		req := authorizationRequest(r.PostForm)
+		// код запоминает, был ли redirect_uri в запросе, поэтому в
+		// AuthorizeUser уходит запрос без подстановки адреса по умолчанию
+		checked := req
+		client, err := a.CheckAuthorization(&checked)
+		if err != nil {
+			authorizeError(w, r, checked, err)
+			return
+		}
+		if r.PostForm.Get("action") == "deny" {
+			authorizeError(w, r, checked, auth.ErrOAuthAccessDenied)
+			return
+		}
+
+		code, err := a.AuthorizeUser(r.Context(), req, r.PostForm.Get("username"), r.PostForm.Get("password"))
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			renderAuthorizeForm(w, r, http.StatusUnauthorized, client, req, "Invalid username or password")
+			return
+		}
+		if err != nil {
+			authorizeError(w, r, checked, err)
+			return
+		}
+
+		redirect := redirectURL(checked, url.Values{"code": {code}})
+		http.Redirect(w, r, redirect, http.StatusFound)
+	}
+}
+
+func authorizationRequest(v url.Values) auth.AuthorizationRequest {
+	return auth.AuthorizationRequest{
+		ResponseType:        v.Get("response_type"),
+		ClientID:            v.Get("client_id"),
+		RedirectURI:         v.Get("redirect_uri"),
+		Scope:               v.Get("scope"),
+		State:               v.Get("state"),
+		CodeChallenge:       v.Get("code_challenge"),
+		CodeChallengeMethod: v.Get("code_challenge_method"),
+	}
+}
+
+// authorizeError отправляет ошибку клиенту редиректом, а если клиент или
+// redirect_uri не подтверждены - показывает ее пользователю
+func authorizeError(w http.ResponseWriter, r *http.Request, req auth.AuthorizationRequest, err error) {
+	var oauthErr *auth.OAuthError
+	if !errors.As(err, &oauthErr) {
+		slog.ErrorContext(r.Context(), "error authorizing oauth client", "err", err)
+		oauthErr = &auth.OAuthError{Code: "server_error"}
+	}
+	if errors.Is(err, auth.ErrOAuthInvalidClient) {
+		writeProblem(w, r, problemInvalidParameter.about("client_id"), oauthErr.Description)
+		return
+	}
+	if errors.Is(err, auth.ErrOAuthInvalidRedirectURI) {
+		writeProblem(w, r, problemInvalidParameter.about("redirect_uri"), oauthErr.Description)
+		return
+	}
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	http.Redirect(w, r, redirectURL(req, params), http.StatusFound)
+}
+
+func redirectURL(req auth.AuthorizationRequest, params url.Values) string {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	sep := "?"
+	if strings.Contains(req.RedirectURI, "?") {
+		sep = "&"
+	}
+	return req.RedirectURI + sep + params.Encode()
+}
+
+// renderAuthorizeForm показывает форму входа с кодом ответа status
+func renderAuthorizeForm(w http.ResponseWriter, r *http.Request, status int, client auth.Client, req auth.AuthorizationRequest, formErr string) {
+	tmpl, err := template.ParseFiles("cmd/server/http/web/templates/oauth_authorize.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error parsing template", "err", err)
+		writeProblem(w, r, problemInternal, "Template parsing error")
+		return
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// форму с паролем нельзя встраивать в чужие страницы
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	page := authorizePage{Client: client, Request: req, Scopes: scopes, Error: formErr}
+	if err := tmpl.Execute(w, page); err != nil {
+		slog.ErrorContext(r.Context(), "error executing template", "err", err)
+	}
+}
+
+// @Summary Token endpoint
+// @Description Issue tokens for client_credentials, authorization_code (with PKCE code_verifier) and refresh_token grants. Confidential clients authenticate with HTTP Basic or client_id and client_secret form fields
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "client_credentials, authorization_code or refresh_token"
+// @Param client_id formData string false "Client ID if HTTP Basic is not used"
+// @Param client_secret formData string false "Client secret if HTTP Basic is not used"
+// @Param scope formData string false "Space separated scopes"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI of the authorization request, required for authorization_code if it was included there"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Success 200 {object} auth.TokenResponse
+// @Router /oauth/token [post]
+func OAuthTokenHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, r, auth.ErrOAuthInvalidRequest)
+			return
+		}
+		clientID, clientSecret := clientCredentials(r)
+		res, err := a.OAuthToken(auth.TokenRequest{
+			GrantType:    r.PostForm.Get("grant_type"),
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Scope:        r.PostForm.Get("scope"),
+			Code:         r.PostForm.Get("code"),
+			RedirectURI:  r.PostForm.Get("redirect_uri"),
+			CodeVerifier: r.PostForm.Get("code_verifier"),
+			RefreshToken: r.PostForm.Get("refresh_token"),
+		})
+		if err != nil {
+			writeOAuthError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// @Summary Token introspection
+// @Description Describe an access or refresh token as in RFC 7662. Only confidential clients may call it
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to introspect"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 {object} auth.Introspection
+// @Router /oauth/introspect [post]
+func IntrospectHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("token") == "" {
+			writeOAuthError(w, r, auth.ErrOAuthInvalidRequest)
+			return
+		}
+		clientID, clientSecret := clientCredentials(r)
+		res, err := a.Introspect(clientID, clientSecret, r.PostForm.Get("token"))
+		if err != nil {
+			writeOAuthError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// clientCredentials данные аутентификации клиента из HTTP Basic или из формы
+func clientCredentials(r *http.Request) (string, string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		return id, secret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+// writeOAuthError ответ с ошибкой в формате RFC 6749 раздел 5.2
+func writeOAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	var oauthErr *auth.OAuthError
+	if !errors.As(err, &oauthErr) {
+		slog.ErrorContext(r.Context(), "oauth token error", "err", err)
+		oauthErr = &auth.OAuthError{Code: "server_error"}
+	}
+	status := http.StatusBadRequest
+	switch oauthErr.Code {
+	case "invalid_client":
+		status = http.StatusUnauthorized
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+	case "server_error":
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(oauthErr)
+}
+
+// CreatedClient зарегистрированный клиент, client_secret больше нигде не возвращается
+type CreatedClient struct {
+	ClientSecret string `json:"client_secret,omitempty"`
+	auth.Client
+}
+
+// @Summary Register an OAuth client
+// @Description Register a third-party application. Confidential clients get a client_secret, public clients may only use authorization_code with PKCE. Requires admin scope
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param client body auth.Client true "Client name, redirect URIs, scopes, grant types and public flag"
+// @Success 201 {object} CreatedClient
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /admin/oauth/clients [post]
+func RegisterClientHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var c auth.Client
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&c); err != nil {
+			writeProblem(w, r, problemInvalidBody, "Request body must be a json with client metadata")
+			return
+		}
+
+		client, secret, err := a.RegisterOAuthClient(c)
+		switch {
+		case errors.Is(err, auth.ErrInvalidClientMetadata):
+			writeProblem(w, r, problemInvalidBody, err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "error registering oauth client", "err", err)
+			writeProblem(w, r, problemInternal, "Failed to register client")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(CreatedClient{ClientSecret: secret, Client: client})
+	}
+}
+
+// @Summary List OAuth clients
+// @Description List registered third-party applications. Requires admin scope
+// @Tags admin
+// @Produce json
+// @Success 200 {array} auth.Client
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Security BearerAuth
+// @Router /admin/oauth/clients [get]
+func ListClientsHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.ListOAuthClients())
+	}
+}
+
+// @Summary Delete an OAuth client
+// @Description Delete a third-party application, its refresh tokens stop working. Requires admin scope
+// @Tags admin
+// @Param id path string true "Client ID"
+// @Success 204
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /admin/oauth/clients/{id} [delete]
+func DeleteClientHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := a.DeleteOAuthClient(r.PathValue("id"))
+		if errors.Is(err, auth.ErrClientNotFound) {
+			writeProblem(w, r, problemNotFound, "Client not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error deleting oauth client", "err", err)
+			writeProblem(w, r, problemInternal, "Failed to delete client")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
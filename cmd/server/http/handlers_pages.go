@@ -2,7 +2,7 @@ package http
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"text/template"
 
@@ -11,22 +11,22 @@ import (
 
 func HTMLPageHandler(a *api.API) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		page, err := a.GetPage(r.Context(), r.Context().Value(PageContextKey).(int), 10)
+		page, err := a.GetPage(r.Context(), r.Context().Value(PageContextKey).(int), a.PageSize, r.Context().Value(TotalContextKey).(int))
 		if err != nil {
-			http.Error(w, "Failed to get page", http.StatusInternalServerError)
+			writeStoreError(w, r, "Failed to get page", err)
 			return
 		}
 		tmpl, err := template.ParseFiles("cmd/server/http/web/templates/index.html")
 		if err != nil {
-			http.Error(w, "Template parsing error", http.StatusInternalServerError)
-			log.Println("Error parsing template:", err)
+			slog.ErrorContext(r.Context(), "error parsing template", "err", err)
+			writeProblem(w, r, problemInternal, "Template parsing error")
 			return
 		}
 
 		err = tmpl.Execute(w, page)
 		if err != nil {
-			http.Error(w, "Template execution error", http.StatusInternalServerError)
-			log.Println("Error executing template:", err)
+			slog.ErrorContext(r.Context(), "error executing template", "err", err)
+			writeProblem(w, r, problemInternal, "Template execution error")
 			return
 		}
 	}
@@ -43,12 +43,22 @@ func HTMLPageHandler(a *api.API) http.HandlerFunc {
 // @Produce json
 // @Param page query int false "Page number"
 // @Success 200 {array} api.Page
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 405 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Failure 503 {object} Problem
+// @Failure 504 {object} Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /api/places/ [get]
 func JSONPageHandler(a *api.API) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		page, err := a.GetPage(r.Context(), r.Context().Value(PageContextKey).(int), 10)
+		page, err := a.GetPage(r.Context(), r.Context().Value(PageContextKey).(int), a.PageSize, r.Context().Value(TotalContextKey).(int))
 		if err != nil {
-			http.Error(w, "Failed to get page", http.StatusInternalServerError)
+			writeStoreError(w, r, "Failed to get page", err)
 			return
 		}
 		// Устанавливаем заголовок Content-Type
@@ -57,7 +67,7 @@ func JSONPageHandler(a *api.API) http.HandlerFunc {
 		// Сериализуем данные в формат JSON
 		jsonResponse, err := json.Marshal(page)
 		if err != nil {
-			http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+			writeProblem(w, r, problemInternal, "Failed to marshal JSON")
 			return
 		}
 
@@ -2,28 +2,37 @@ package http
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/zkhrg/go_day03/internal/api"
 )
 
 // @Summary Get a 3 nearest eating places by lat and lon params
-// @Description Get a 3 nearest eating places by lat and lon params using arc formula
+// @Description Get a 3 nearest eating places by lat and lon params using arc formula. Requires places:read scope
 // @Tags recommendations
 // @Produce json
 // @Param lat query float64 false "latitude"
 // @Param lon query float64 false "longitude"
 // @Success 200 {array} places.Place
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 405 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Failure 503 {object} Problem
+// @Failure 504 {object} Problem
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /api/recommend/ [get]
 func NearestPlacesHandler(a *api.API) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		lat := r.Context().Value(LatContextKey).(float64)
 		lon := r.Context().Value(LonContextKey).(float64)
-		response, err := a.Store.GetNearestPlaces(lat, lon)
+		response, err := a.Store.GetNearestPlaces(r.Context(), lat, lon)
 		if err != nil {
-			log.Printf("handler nearest places can not get a nearest places from strore")
+			writeStoreError(w, r, "Failed to get nearest places", err)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
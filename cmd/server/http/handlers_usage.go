@@ -0,0 +1,35 @@
+package http
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/zkhrg/go_day03/internal/api"
+)
+
+// @Summary Get my quota usage
+// @Description Get plan of the current user or API key and usage of its daily and monthly quotas
+// @Tags usage
+// @Produce json
+// @Success 200 {object} quota.Usage
+// @Failure 401 {object} Problem
+// @Failure 405 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/me/usage [get]
+func UsageHandler(a *api.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		usage, err := a.Usage(r.Context(), principal.Key())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error getting quota usage", "err", err)
+			writeProblem(w, r, problemInternal, "Failed to get usage")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(usage)
+	}
+}
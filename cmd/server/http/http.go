@@ -1,40 +1,188 @@
 package http
 
 import (
+	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/zkhrg/go_day03/internal/api"
+	"github.com/zkhrg/go_day03/internal/auth"
+	"github.com/zkhrg/go_day03/internal/metrics"
 )
 
 func AddPlacesRoutes(a *api.API, mux *http.ServeMux) {
 	// Создаем цепочку миддлварей и передаем API через замыкание
 	HTMLPaginatedChain := ChainMiddleware(
-		HTMLPageHandler(a),      // Передаем API в хендлер html-ки
-		GetMethodMiddleware,     // первое что мы делаем это миддлеварь на гет запрос
-		PaginationMiddleware(a), // затем проверяем что у нас предоставлен page
+		HTMLPageHandler(a),               // Передаем API в хендлер html-ки
+		GetMethodMiddleware,              // первое что мы делаем это миддлеварь на гет запрос
+		APIKeyMiddleware(a),              // ключ необязателен, но с ним лимит считается по клиенту, а не по IP
+		OptionalTokenMiddleware(a),       // как и bearer токен
+		RateLimitMiddleware(a, "places"), // глубокое листание нагружает эластик, ограничиваем частоту
+		PaginationMiddleware(a),          // затем проверяем что у нас предоставлен page
 	)
 
 	JSONPaginatedChain := ChainMiddleware(
 		JSONPageHandler(a),
 		GetMethodMiddleware,
+		APIKeyMiddleware(a),
+		OptionalTokenMiddleware(a),
+		RateLimitMiddleware(a, "places"),
 		PaginationMiddleware(a),
 	)
 
 	JSONRecommendChain := ChainMiddleware(
 		NearestPlacesHandler(a),
 		GetMethodMiddleware,
+		APIKeyMiddleware(a),
 		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopePlacesRead),
+		RateLimitMiddleware(a, "recommend"),
 		LatLonMiddleware,
+		QuotaMiddleware(a, "recommend"),
 	)
 
-	getTokenChain := ChainMiddleware(
-		generateTokenHandler(a),
+	usageChain := ChainMiddleware(
+		UsageHandler(a),
 		GetMethodMiddleware,
-		UsernameMiddleware,
+		APIKeyMiddleware(a),
+		ValidateTokenMiddleware(a),
+	)
+
+	signUpChain := ChainMiddleware(
+		signUpHandler(a),
+		PostMethodMiddleware,
+		CredentialsMiddleware,
+	)
+
+	loginChain := ChainMiddleware(
+		loginHandler(a),
+		PostMethodMiddleware,
+		CredentialsMiddleware,
+	)
+
+	refreshTokenChain := ChainMiddleware(
+		refreshTokenHandler(a),
+		PostMethodMiddleware,
+		RefreshTokenMiddleware,
+	)
+
+	revokeTokenChain := ChainMiddleware(
+		revokeTokenHandler(a),
+		PostMethodMiddleware,
+		RefreshTokenMiddleware,
+	)
+
+	jwksChain := ChainMiddleware(
+		jwksHandler(a),
+		GetMethodMiddleware,
+	)
+
+	uploadDatasetChain := ChainMiddleware(
+		UploadDatasetHandler(a),
+		PostMethodMiddleware,
+		APIKeyMiddleware(a),
+		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopeAdmin),
+	)
+
+	importJobChain := ChainMiddleware(
+		ImportJobHandler(a),
+		GetMethodMiddleware,
+		APIKeyMiddleware(a),
+		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopeAdmin),
+	)
+
+	// управлять ключами можно только с токеном администратора, сам API ключ
+	// не должен выпускать новые ключи
+	createAPIKeyChain := ChainMiddleware(
+		CreateAPIKeyHandler(a),
+		PostMethodMiddleware,
+		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopeAdmin),
+	)
+
+	listAPIKeysChain := ChainMiddleware(
+		ListAPIKeysHandler(a),
+		GetMethodMiddleware,
+		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopeAdmin),
+	)
+
+	revokeAPIKeyChain := ChainMiddleware(
+		RevokeAPIKeyHandler(a),
+		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopeAdmin),
+	)
+
+	registerClientChain := ChainMiddleware(
+		RegisterClientHandler(a),
+		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopeAdmin),
 	)
 
-	mux.Handle("/api/recommend/{$}", JSONRecommendChain)
-	mux.Handle("/api/places/{$}", JSONPaginatedChain)
-	mux.Handle("/api/get_token/{$}", getTokenChain)
-	mux.Handle("/{$}", HTMLPaginatedChain)
+	listClientsChain := ChainMiddleware(
+		ListClientsHandler(a),
+		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopeAdmin),
+	)
+
+	deleteClientChain := ChainMiddleware(
+		DeleteClientHandler(a),
+		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopeAdmin),
+	)
+
+	configChain := ChainMiddleware(
+		ConfigHandler(a),
+		APIKeyMiddleware(a),
+		ValidateTokenMiddleware(a),
+		RequireScope(auth.ScopeAdmin),
+	)
+
+	// каждый маршрут считается в метриках, access логе и трейсах под своим
+	// шаблоном без метода. Пробы и сбор метрик дергаются постоянно, их
+	// запросы пишутся только в debug
+	handle := func(pattern string, h http.Handler) {
+		route := pattern
+		if _, path, ok := strings.Cut(pattern, " "); ok {
+			route = path
+		}
+		level := slog.LevelInfo
+		if route == "/healthz" || route == "/readyz" || route == "/metrics" {
+			level = slog.LevelDebug
+		}
+		mux.Handle(pattern, ChainMiddleware(h,
+			TracingMiddleware(route),
+			AccessLogMiddleware(route, level),
+			MetricsMiddleware(route),
+			DeadlineMiddleware(a.RequestTimeout),
+		))
+	}
+
+	handle("GET /healthz", HealthzHandler())
+	handle("GET /metrics", metrics.Handler())
+	handle("GET /readyz", ReadyzHandler(a))
+	handle("/api/recommend/{$}", JSONRecommendChain)
+	handle("/api/places/{$}", JSONPaginatedChain)
+	handle("/api/me/usage", usageChain)
+	handle("/api/signup/{$}", signUpChain)
+	handle("/api/login/{$}", loginChain)
+	handle("/api/token/refresh", refreshTokenChain)
+	handle("/api/token/revoke", revokeTokenChain)
+	handle("/.well-known/jwks.json", jwksChain)
+	handle("/admin/datasets", uploadDatasetChain)
+	handle("/admin/jobs/{id}", importJobChain)
+	handle("POST /admin/api-keys", createAPIKeyChain)
+	handle("GET /admin/api-keys", listAPIKeysChain)
+	handle("DELETE /admin/api-keys/{id}", revokeAPIKeyChain)
+	handle("GET /oauth/authorize", AuthorizeFormHandler(a))
+	handle("POST /oauth/authorize", AuthorizeHandler(a))
+	handle("POST /oauth/token", OAuthTokenHandler(a))
+	handle("POST /oauth/introspect", IntrospectHandler(a))
+	handle("POST /admin/oauth/clients", registerClientChain)
+	handle("GET /admin/oauth/clients", listClientsChain)
+	handle("DELETE /admin/oauth/clients/{id}", deleteClientChain)
+	handle("GET /admin/config", configChain)
+	handle("/{$}", HTMLPaginatedChain)
 }
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// принимаем только короткие идентификаторы из безопасных символов, чтобы
+// клиент не мог подсунуть в логи что угодно
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware берет X-Request-ID из запроса или выдает новый,
+// кладет его в контекст для логов и возвращает в ответе
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDRe.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLogMiddleware пишет строку лога на каждый запрос к маршруту route.
+// request_id и пользователь добавляются логгером из контекста
+func AccessLogMiddleware(route string, level slog.Level) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			lvl := level
+			if rec.status >= http.StatusInternalServerError {
+				lvl = slog.LevelError
+			}
+			slog.LogAttrs(r.Context(), lvl, "request",
+				slog.String("method", r.Method),
+				slog.String("route", route),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/metrics"
+)
+
+// statusRecorder запоминает код ответа для метрик
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap нужен http.ResponseController, чтобы добраться до Flush и таймаутов
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// MetricsMiddleware считает запросы и их длительность по маршруту route.
+// Маршрут передается шаблоном, а не путем запроса, чтобы число временных
+// рядов не зависело от запросов клиентов
+func MetricsMiddleware(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			metrics.ObserveHTTP(route, r.Method, rec.status, time.Since(start))
+		})
+	}
+}
@@ -2,20 +2,34 @@ package http
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zkhrg/go_day03/internal/api"
+	"github.com/zkhrg/go_day03/internal/auth"
+	"github.com/zkhrg/go_day03/internal/logging"
+	"github.com/zkhrg/go_day03/internal/quota"
 )
 
 type contextKey string
 
 const (
-	PageContextKey     contextKey = "page"
-	LatContextKey      contextKey = "lat"
-	LonContextKey      contextKey = "lon"
-	UsernameContextKey contextKey = "username"
+	PageContextKey         contextKey = "page"
+	TotalContextKey        contextKey = "total"
+	LatContextKey          contextKey = "lat"
+	LonContextKey          contextKey = "lon"
+	CredentialsContextKey  contextKey = "credentials"
+	RefreshTokenContextKey contextKey = "refresh_token"
+	ClaimsContextKey       contextKey = "claims"
+	PrincipalContextKey    contextKey = "principal"
 )
 
 func ChainMiddleware(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
@@ -27,26 +41,52 @@ func ChainMiddleware(handler http.Handler, middlewares ...func(http.Handler) htt
 	return handler
 }
 
-func PaginationMiddleware(a *api.API) func(http.Handler) http.Handler {
+// DeadlineMiddleware ограничивает обработку запроса временем d. Дедлайн
+// доходит до вызовов эластика через контекст, 0 - без ограничения
+func DeadlineMiddleware(d time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func PaginationMiddleware(a *api.API) func(http.Handler) http.Handler {
+	return TraceStage("pagination", func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			pageParam := r.URL.Query().Get("page")
 
 			if pageParam == "" {
-				http.Error(w, "Missing 'page' parameter", http.StatusBadRequest)
+				writeProblem(w, r, problemInvalidParameter.about("page"), "Missing 'page' parameter")
 				return
 			}
 
 			page, err := strconv.Atoi(pageParam)
-			if err != nil || page < 1 || page > api.GetPagesCount(10, a.Store.GetTotalRecords()) {
-				http.Error(w, "'page' parameter must be a positive integer and dont overflow pages count", http.StatusBadRequest)
+			if err != nil || page < 1 {
+				writeProblem(w, r, problemInvalidParameter.about("page"), "'page' parameter must be a positive integer")
+				return
+			}
+			total, err := a.Store.GetTotalRecords(r.Context())
+			if err != nil {
+				writeStoreError(w, r, "Failed to count places", err)
+				return
+			}
+			if pages := api.GetPagesCount(a.PageSize, total); page > pages {
+				writeProblem(w, r, problemInvalidParameter.about("page"), fmt.Sprintf("'page' parameter must not exceed pages count %d", pages))
 				return
 			}
 
+			// число мест считается один раз на запрос и дальше передается вниз
 			ctx := context.WithValue(r.Context(), PageContextKey, page)
+			ctx = context.WithValue(ctx, TotalContextKey, total)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
-	}
+	})
 }
 
 func LatLonMiddleware(next http.Handler) http.Handler {
@@ -54,20 +94,24 @@ func LatLonMiddleware(next http.Handler) http.Handler {
 		latParam := r.URL.Query().Get("lat")
 		lonParam := r.URL.Query().Get("lon")
 
-		if latParam == "" || lonParam == "" {
-			http.Error(w, "Missing 'lat' or 'lon' parameter", http.StatusBadRequest)
+		if latParam == "" {
+			writeProblem(w, r, problemInvalidParameter.about("lat"), "Missing 'lat' parameter")
+			return
+		}
+		if lonParam == "" {
+			writeProblem(w, r, problemInvalidParameter.about("lon"), "Missing 'lon' parameter")
 			return
 		}
 
 		lat, err := strconv.ParseFloat(latParam, 64)
 		if err != nil {
-			http.Error(w, "'lat' parameter must be a valid float", http.StatusBadRequest)
+			writeProblem(w, r, problemInvalidParameter.about("lat"), "'lat' parameter must be a valid float")
 			return
 		}
 
 		lon, err := strconv.ParseFloat(lonParam, 64)
 		if err != nil {
-			http.Error(w, "'lon' parameter must be a valid float", http.StatusBadRequest)
+			writeProblem(w, r, problemInvalidParameter.about("lon"), "'lon' parameter must be a valid float")
 			return
 		}
 
@@ -81,7 +125,8 @@ func LatLonMiddleware(next http.Handler) http.Handler {
 func GetMethodMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			w.Header().Set("Allow", http.MethodGet)
+			writeProblem(w, r, problemMethodNotAllowed, "Use "+http.MethodGet)
 			return
 		}
 
@@ -92,7 +137,8 @@ func GetMethodMiddleware(next http.Handler) http.Handler {
 func PostMethodMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			w.Header().Set("Allow", http.MethodPost)
+			writeProblem(w, r, problemMethodNotAllowed, "Use "+http.MethodPost)
 			return
 		}
 
@@ -100,25 +146,104 @@ func PostMethodMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// ValidateTokenMiddleware проверяет bearer токен и кладет в контекст его
+// claims и принципала. Запрос, уже аутентифицированный API ключом, пропускается
 func ValidateTokenMiddleware(a *api.API) func(http.Handler) http.Handler {
+	return TraceStage("auth.token", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := PrincipalFromContext(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Header.Get("Authorization") == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				writeProblem(w, r, problemUnauthorized, "Missing Authorization header")
+				return
+			}
+
+			token, ok := bearerToken(r)
+			if !ok {
+				setWWWAuthenticate(w, "invalid_request", "Authorization header must be 'Bearer <token>'")
+				writeProblem(w, r, problemInvalidParameter.about("Authorization"), "Authorization header must be 'Bearer <token>'")
+				return
+			}
+
+			claims, err := a.ValidateToken(token)
+			if err != nil {
+				var tokenErr *auth.TokenError
+				if !errors.As(err, &tokenErr) {
+					tokenErr = auth.ErrMalformedToken
+				}
+				setWWWAuthenticate(w, tokenErr.Code, tokenErr.Description)
+				writeProblem(w, r, problemInvalidToken, "Invalid token: "+tokenErr.Description)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
+			ctx = context.WithValue(ctx, PrincipalContextKey, claims.Principal())
+			logging.SetUser(ctx, claims.Principal().Username)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
+
+// OptionalTokenMiddleware проверяет bearer токен, только если клиент его
+// прислал. Нужна открытым маршрутам, где лимиты считаются по пользователю:
+// без заголовка запрос идет дальше анонимным, с неверным токеном - отклоняется
+func OptionalTokenMiddleware(a *api.API) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
+		validate := ValidateTokenMiddleware(a)(next)
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
 				return
 			}
+			validate.ServeHTTP(w, r)
+		})
+	}
+}
 
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+// APIKeyMiddleware аутентифицирует запрос по заголовку X-API-Key. Без
+// заголовка запрос идет дальше, обычно в ValidateTokenMiddleware
+func APIKeyMiddleware(a *api.API) func(http.Handler) http.Handler {
+	return TraceStage("auth.api_key", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret := r.Header.Get("X-API-Key")
+			if secret == "" {
+				next.ServeHTTP(w, r)
 				return
 			}
-			token := parts[1]
 
-			tokenValid := a.ValidateToken(token)
-			if !tokenValid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+			key, err := a.AuthenticateAPIKey(secret)
+			if err != nil {
+				writeProblem(w, r, problemInvalidToken.about("X-API-Key"), err.Error())
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), PrincipalContextKey, key.Principal())
+			logging.SetUser(ctx, key.Principal().Username)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
+
+// RequireScope пропускает запрос, только если у токена или API ключа есть
+// scope. Ставится после ValidateTokenMiddleware, которая кладет принципала в контекст
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				writeProblem(w, r, problemUnauthorized, "Missing Authorization header")
+				return
+			}
+
+			if !principal.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate",
+					fmt.Sprintf(`Bearer realm="api", error="insufficient_scope", scope=%q`, scope))
+				writeProblem(w, r, problemInsufficientScope, "Token lacks required scope: "+scope)
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -126,16 +251,176 @@ func ValidateTokenMiddleware(a *api.API) func(http.Handler) http.Handler {
 	}
 }
 
-func UsernameMiddleware(next http.Handler) http.Handler {
+// ClaimsFromContext claims токена, проверенного ValidateTokenMiddleware
+func ClaimsFromContext(ctx context.Context) (*auth.JWTClaims, bool) {
+	claims, ok := ctx.Value(ClaimsContextKey).(*auth.JWTClaims)
+	return claims, ok
+}
+
+// PrincipalFromContext от чьего имени выполняется запрос: пользователя
+// с токеном или API ключа
+func PrincipalFromContext(ctx context.Context) (auth.Principal, bool) {
+	principal, ok := ctx.Value(PrincipalContextKey).(auth.Principal)
+	return principal, ok
+}
+
+// CredentialsMiddleware читает логин и пароль из json тела запроса
+func CredentialsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var creds Credentials
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&creds); err != nil {
+			writeProblem(w, r, problemInvalidBody, "Request body must be a json with 'username' and 'password'")
+			return
+		}
+
+		if creds.Username == "" {
+			writeProblem(w, r, problemInvalidBody.about("username"), "Missing 'username' field")
+			return
+		}
+		if creds.Password == "" {
+			writeProblem(w, r, problemInvalidBody.about("password"), "Missing 'password' field")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), CredentialsContextKey, creds)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// setWWWAuthenticate заголовок ответа на неудачную аутентификацию по RFC 6750
+func setWWWAuthenticate(w http.ResponseWriter, code, description string) {
+	w.Header().Set("WWW-Authenticate",
+		fmt.Sprintf(`Bearer realm="api", error=%q, error_description=%q`, code, description))
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// RefreshTokenMiddleware читает refresh токен из json тела запроса
+func RefreshTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		usernameParam := r.URL.Query().Get("username")
+		var req RefreshRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeProblem(w, r, problemInvalidBody, "Request body must be a json with 'refresh_token'")
+			return
+		}
 
-		if usernameParam == "" {
-			http.Error(w, "Missing 'username' parameter", http.StatusBadRequest)
+		if req.RefreshToken == "" {
+			writeProblem(w, r, problemInvalidBody.about("refresh_token"), "Missing 'refresh_token' field")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), UsernameContextKey, usernameParam)
+		ctx := context.WithValue(r.Context(), RefreshTokenContextKey, req.RefreshToken)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RateLimitMiddleware ограничивает частоту запросов к маршруту route.
+// Клиент определяется по API ключу или пользователю из контекста, поэтому
+// middleware ставится после аутентификации, анонимные клиенты - по IP
+func RateLimitMiddleware(a *api.API, route string) func(http.Handler) http.Handler {
+	return TraceStage("rate_limit", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, limit, ok, err := a.AllowRequest(r.Context(), route, rateLimitKey(r, a.Limiter.TrustForwardedFor()))
+			if err != nil {
+				// при недоступном хранилище лимитов лучше пропустить запрос, чем отказать всем
+				slog.ErrorContext(r.Context(), "rate limit store error", "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			w.Header().Set("RateLimit-Policy",
+				fmt.Sprintf("%d;w=%d", limit.Burst, ceilSeconds(time.Duration(float64(limit.Burst)/limit.Rate*float64(time.Second)))))
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				writeProblem(w, r, problemRateLimited, fmt.Sprintf("Rate limit of %s exceeded, retry in %d seconds", route, ceilSeconds(res.RetryAfter)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+// rateLimitKey за кем считать запросы: API ключ, пользователь или адрес клиента
+func rateLimitKey(r *http.Request, trustForwardedFor bool) string {
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		return principal.Key()
+	}
+	return "ip:" + clientIP(r, trustForwardedFor)
+}
+
+// clientIP адрес клиента. За прокси берется последний адрес X-Forwarded-For:
+// его дописал наш прокси, а более ранние клиент мог подставить сам
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(fwd[len(fwd)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// QuotaMiddleware учитывает использование платной метрики metric и
+// отклоняет запрос, когда дневная или месячная квота плана исчерпана.
+// Использование резервируется до обработки, чтобы параллельные запросы не
+// превысили квоту, и возвращается, если ответ 5xx или клиент не дождался его.
+// Ставится после аутентификации
+func QuotaMiddleware(a *api.API, metric string) func(http.Handler) http.Handler {
+	return TraceStage("quota", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				writeProblem(w, r, problemUnauthorized, "Missing Authorization header")
+				return
+			}
+
+			charge, err := a.ConsumeQuota(r.Context(), principal.Key(), metric)
+			var exceeded *quota.ExceededError
+			if errors.As(err, &exceeded) {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(time.Until(exceeded.Reset))))
+				writeProblem(w, r, problemQuotaExceeded, exceeded.Error())
+				return
+			}
+			if err != nil {
+				// учет недоступен - не блокируем пользователей из-за этого
+				slog.ErrorContext(r.Context(), "quota store error", "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status < http.StatusInternalServerError && rec.status != statusClientClosedRequest {
+				return
+			}
+			// запрос мог быть отменен клиентом, возврат все равно нужен
+			if err := a.RefundQuota(context.WithoutCancel(r.Context()), charge); err != nil {
+				slog.ErrorContext(r.Context(), "cannot refund quota", "err", err)
+			}
+		})
+	})
+}
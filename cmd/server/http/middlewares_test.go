@@ -0,0 +1,233 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/zkhrg/go_day03/internal/api"
+	"github.com/zkhrg/go_day03/internal/auth"
+	"github.com/zkhrg/go_day03/internal/quota"
+	"github.com/zkhrg/go_day03/internal/ratelimit"
+)
+
+// respond отвечает кодом status, если до него дошел запрос
+func respond(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+}
+
+// withPrincipal запрос, уже аутентифицированный как username
+func withPrincipal(r *http.Request, username string) *http.Request {
+	ctx := context.WithValue(r.Context(), PrincipalContextKey, auth.Principal{Username: username, Roles: []string{auth.RoleUser}})
+	return r.WithContext(ctx)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	a := &api.API{Limiter: ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Config{
+		Routes: map[string]ratelimit.Limit{"recommend": {Rate: 1.0 / 60, Burst: 2}},
+	})}
+	h := RateLimitMiddleware(a, "recommend")(respond(http.StatusOK))
+
+	steps := []struct {
+		remoteAddr    string
+		wantStatus    int
+		wantRemaining string
+	}{
+		{"10.0.0.1:1000", http.StatusOK, "1"},
+		{"10.0.0.1:1001", http.StatusOK, "0"},
+		{"10.0.0.1:1002", http.StatusTooManyRequests, "0"},
+		// лимит считается по адресу клиента
+		{"10.0.0.2:1000", http.StatusOK, "1"},
+	}
+	for i, st := range steps {
+		r := httptest.NewRequest(http.MethodGet, "/api/recommend/", nil)
+		r.RemoteAddr = st.remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		if rec.Code != st.wantStatus {
+			t.Fatalf("step %d: status = %d, want %d", i, rec.Code, st.wantStatus)
+		}
+		if got := rec.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("step %d: RateLimit-Limit = %q, want 2", i, got)
+		}
+		if got := rec.Header().Get("RateLimit-Remaining"); got != st.wantRemaining {
+			t.Errorf("step %d: RateLimit-Remaining = %q, want %q", i, got, st.wantRemaining)
+		}
+		if st.wantStatus != http.StatusTooManyRequests {
+			continue
+		}
+		if got := rec.Header().Get("Retry-After"); got != "60" {
+			t.Errorf("step %d: Retry-After = %q, want 60", i, got)
+		}
+		if p := decodeProblem(t, rec); p.Type != "/problems/rate-limited" {
+			t.Errorf("step %d: type = %q, want /problems/rate-limited", i, p.Type)
+		}
+	}
+}
+
+func TestQuotaMiddleware(t *testing.T) {
+	store, err := quota.NewFileStore(filepath.Join(t.TempDir(), "usage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meter, err := quota.NewMeter(store, quota.Plans{
+		DefaultPlan: "free",
+		Plans:       map[string]quota.Plan{"free": {Limits: map[string]quota.Limit{"recommend": {Daily: 1}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &api.API{Quotas: meter}
+
+	steps := []struct {
+		name       string
+		user       string // пусто - запрос без аутентификации
+		handler    int
+		wantStatus int
+		wantType   string
+	}{
+		{"anonymous", "", http.StatusOK, http.StatusUnauthorized, "/problems/unauthorized"},
+		// ответ 5xx не тратит квоту
+		{"failed request", "alice", http.StatusServiceUnavailable, http.StatusServiceUnavailable, ""},
+		{"first request", "alice", http.StatusOK, http.StatusOK, ""},
+		{"quota exceeded", "alice", http.StatusOK, http.StatusTooManyRequests, "/problems/quota-exceeded"},
+		{"other user", "bob", http.StatusOK, http.StatusOK, ""},
+	}
+	for _, st := range steps {
+		h := QuotaMiddleware(a, "recommend")(respond(st.handler))
+		r := httptest.NewRequest(http.MethodGet, "/api/recommend/", nil)
+		if st.user != "" {
+			r = withPrincipal(r, st.user)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		if rec.Code != st.wantStatus {
+			t.Fatalf("%s: status = %d, want %d", st.name, rec.Code, st.wantStatus)
+		}
+		if st.wantType == "" {
+			continue
+		}
+		if p := decodeProblem(t, rec); p.Type != st.wantType {
+			t.Errorf("%s: type = %q, want %q", st.name, p.Type, st.wantType)
+		}
+		switch st.wantStatus {
+		case http.StatusUnauthorized:
+			if got := rec.Header().Get("WWW-Authenticate"); got != `Bearer realm="api"` {
+				t.Errorf("%s: WWW-Authenticate = %q", st.name, got)
+			}
+		case http.StatusTooManyRequests:
+			if rec.Header().Get("Retry-After") == "" {
+				t.Errorf("%s: Retry-After is missing", st.name)
+			}
+		}
+	}
+}
+
+func TestValidateTokenMiddleware(t *testing.T) {
+	keys, err := auth.NewKeyStore(func() (*auth.KeySet, error) {
+		return &auth.KeySet{Primary: "k1", Keys: map[string]auth.Key{
+			"k1": {ID: "k1", Alg: auth.AlgHS256, Secret: []byte("0123456789abcdef0123456789abcdef")},
+		}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.NewTokens(keys, auth.TokensConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := auth.NewSessions(tokens, 0)
+	a := &api.API{Tokens: tokens, Sessions: sessions}
+
+	issue := func() string {
+		pair, err := sessions.Issue(auth.Principal{Username: "alice", Roles: []string{auth.RoleUser}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pair.Token
+	}
+	valid := issue()
+	revoked := issue()
+	claims, err := tokens.ValidateToken(revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions.RevokeAccess(claims)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantType      string
+		wantWWWAuth   string
+	}{
+		{
+			name:        "missing header",
+			wantStatus:  http.StatusUnauthorized,
+			wantType:    "/problems/unauthorized",
+			wantWWWAuth: `Bearer realm="api"`,
+		},
+		{
+			name:          "not bearer",
+			authorization: "Basic YWxpY2U6cGFzcw==",
+			wantStatus:    http.StatusBadRequest,
+			wantType:      "/problems/invalid-parameter",
+			wantWWWAuth:   `Bearer realm="api", error="invalid_request", error_description="Authorization header must be 'Bearer <token>'"`,
+		},
+		{
+			name:          "malformed token",
+			authorization: "Bearer not-a-jwt",
+			wantStatus:    http.StatusUnauthorized,
+			wantType:      "/problems/invalid-token",
+			wantWWWAuth:   `Bearer realm="api", error="invalid_token", error_description="token is malformed"`,
+		},
+		{
+			name:          "revoked token",
+			authorization: "Bearer " + revoked,
+			wantStatus:    http.StatusUnauthorized,
+			wantType:      "/problems/invalid-token",
+			wantWWWAuth:   `Bearer realm="api", error="invalid_token", error_description="` + auth.ErrTokenRevoked.Description + `"`,
+		},
+		{
+			name:          "valid token",
+			authorization: "Bearer " + valid,
+			wantStatus:    http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var principal auth.Principal
+			h := ValidateTokenMiddleware(a)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = PrincipalFromContext(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/api/me/usage", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.wantWWWAuth {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantWWWAuth)
+			}
+			if tt.wantType == "" {
+				if principal.Username != "alice" {
+					t.Errorf("principal = %+v, want alice", principal)
+				}
+				return
+			}
+			if p := decodeProblem(t, rec); p.Type != tt.wantType {
+				t.Errorf("type = %q, want %q", p.Type, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HSTSMiddleware просит браузер ходить на сервис только по HTTPS следующие
+// maxAge. Ставится только на HTTPS сервер
+func HSTSMiddleware(maxAge time.Duration, includeSubdomains bool) func(http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Strict-Transport-Security", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RedirectToHTTPSHandler перенаправляет запросы по HTTP на тот же путь по
+// HTTPS на порт адреса httpsAddr. 308 сохраняет метод и тело запроса
+func RedirectToHTTPSHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zkhrg/go_day03/internal/tracing"
+)
+
+// TracingMiddleware открывает серверный спан на запрос к маршруту route.
+// Если клиент прислал W3C traceparent, спан продолжает его трейс
+func TracingMiddleware(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("http.route", route),
+					attribute.String("url.path", r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rec.status))
+			}
+		})
+	}
+}
+
+type stageKey struct{}
+
+// stage спан стадии и спан, внутри которого она началась
+type stage struct {
+	span, parent trace.Span
+}
+
+// TraceStage оборачивает миддлварь mw в спан name. Спан длится, пока
+// миддлварь не передаст запрос дальше или не ответит сама, а следующие
+// стадии и хендлер становятся соседями, а не детьми этого спана
+func TraceStage(name string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		inner := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			st := r.Context().Value(stageKey{}).(*stage)
+			st.span.End()
+			// значения, которые миддлварь положила в контекст, сохраняются
+			ctx := trace.ContextWithSpan(r.Context(), st.parent)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parent := trace.SpanFromContext(r.Context())
+			ctx, span := tracing.Start(r.Context(), name)
+			ctx = context.WithValue(ctx, stageKey{}, &stage{span: span, parent: parent})
+			inner.ServeHTTP(w, r.WithContext(ctx))
+			// миддлварь ответила сама, повторный End ничего не делает
+			span.End()
+		})
+	}
+}
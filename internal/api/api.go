@@ -2,22 +2,121 @@ package api
 
 import (
 	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
 
+	"github.com/zkhrg/go_day03/internal/auth"
 	"github.com/zkhrg/go_day03/internal/places"
+	"github.com/zkhrg/go_day03/internal/quota"
+	"github.com/zkhrg/go_day03/internal/ratelimit"
 )
 
 type API struct {
-	Store Store
+	Store    Store
+	Users    *auth.Registry
+	Tokens   *auth.Tokens
+	Sessions *auth.Sessions
+	APIKeys  *auth.APIKeys
+	OAuth    *auth.OAuth
+	Limiter  *ratelimit.Limiter
+	Quotas   *quota.Meter
+	// мест на одной странице /api/places/ и HTML страницы
+	PageSize int
+	// сколько времени дается на обработку одного запроса, 0 - без ограничения
+	RequestTimeout time.Duration
+	// действующие настройки без секретов для /admin/config
+	Config map[string]any
+	jobs   *jobRegistry
+	// индекс загружен при старте, до этого сервис не готов принимать трафик
+	ready atomic.Bool
 }
 
+const DefaultPageSize = 10
+
 type Store interface {
-	GetPlacesByPageParams(ctx context.Context, pageNumber int, pageSize int) ([]places.Place, error)
-	GetNearestPlaces(lat, lon float64) ([]places.Place, error)
-	GetTotalRecords() int
+	GetPlacesByPageParams(ctx context.Context, pageNumber int, pageSize int, recordsCount int) ([]places.Place, error)
+	GetNearestPlaces(ctx context.Context, lat, lon float64) ([]places.Place, error)
+	GetTotalRecords(ctx context.Context) (int, error)
+	IndexPlaces(ctx context.Context, r io.Reader, opts places.ImportOptions, report *places.ImportReport) error
+	Ping(ctx context.Context) error
+}
+
+// Options зависимости и настройки API
+type Options struct {
+	Store    Store
+	Users    *auth.Registry
+	Tokens   *auth.Tokens
+	Sessions *auth.Sessions
+	APIKeys  *auth.APIKeys
+	OAuth    *auth.OAuth
+	Limiter  *ratelimit.Limiter
+	Quotas   *quota.Meter
+	// 0 - DefaultPageSize
+	PageSize       int
+	RequestTimeout time.Duration
+	Config         map[string]any
 }
 
-func NewStoreAPI(s Store) *API {
+func NewStoreAPI(opts Options) *API {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
 	return &API{
-		Store: s,
+		Store:          opts.Store,
+		Users:          opts.Users,
+		Tokens:         opts.Tokens,
+		Sessions:       opts.Sessions,
+		APIKeys:        opts.APIKeys,
+		OAuth:          opts.OAuth,
+		Limiter:        opts.Limiter,
+		Quotas:         opts.Quotas,
+		PageSize:       pageSize,
+		RequestTimeout: opts.RequestTimeout,
+		Config:         opts.Config,
+		jobs:           newJobRegistry(),
+	}
+}
+
+// AllowRequest тратит токен лимита маршрута route для клиента key
+func (a *API) AllowRequest(ctx context.Context, route, key string) (ratelimit.Result, ratelimit.Limit, bool, error) {
+	return a.Limiter.Allow(ctx, route, key)
+}
+
+// ConsumeQuota учитывает одно использование метрики клиентом subject
+func (a *API) ConsumeQuota(ctx context.Context, subject, metric string) (quota.Charge, error) {
+	return a.Quotas.Consume(ctx, subject, metric)
+}
+
+// RefundQuota возвращает использование, если запрос не удался
+func (a *API) RefundQuota(ctx context.Context, charge quota.Charge) error {
+	return a.Quotas.Refund(ctx, charge)
+}
+
+// Usage использование квот клиентом subject в текущем дне и месяце
+func (a *API) Usage(ctx context.Context, subject string) (quota.Usage, error) {
+	return a.Quotas.Usage(ctx, subject)
+}
+
+var ErrNotReady = errors.New("places index is not loaded yet")
+
+// SetReady отмечает готовность принимать трафик: после загрузки индекса
+// и снимается в начале остановки сервера
+func (a *API) SetReady(ready bool) {
+	a.ready.Store(ready)
+}
+
+// IndexLoaded индекс загружен при старте и сервис не останавливается
+func (a *API) IndexLoaded() bool {
+	return a.ready.Load()
+}
+
+// Readiness nil, если индекс загружен и эластик сейчас отвечает
+func (a *API) Readiness(ctx context.Context) error {
+	if !a.ready.Load() {
+		return ErrNotReady
 	}
+	return a.Store.Ping(ctx)
 }
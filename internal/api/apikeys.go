@@ -0,0 +1,24 @@
+package api
+
+import (
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/auth"
+)
+
+// CreateAPIKey выпускает ключ, открытое значение возвращается только здесь
+func (a *API) CreateAPIKey(name string, scopes []string, expiresAt *time.Time, createdBy string) (auth.APIKey, string, error) {
+	return a.APIKeys.Create(name, scopes, expiresAt, createdBy)
+}
+
+func (a *API) ListAPIKeys() []auth.APIKey {
+	return a.APIKeys.List()
+}
+
+func (a *API) RevokeAPIKey(id string) error {
+	return a.APIKeys.Revoke(id)
+}
+
+func (a *API) AuthenticateAPIKey(key string) (auth.APIKey, error) {
+	return a.APIKeys.Authenticate(key)
+}
@@ -1,23 +1,52 @@
 package api
 
 import (
-	"log"
+	"context"
 
 	"github.com/zkhrg/go_day03/internal/auth"
 )
 
-func (a *API) GetTokenByName(username string) (string, error) {
-	token, err := auth.GetTokenByName(username)
+// ValidateToken проверяет подпись и claims токена, а также что он не был отозван
+func (a *API) ValidateToken(token string) (*auth.JWTClaims, error) {
+	claims, err := a.Tokens.ValidateToken(token)
 	if err != nil {
-		log.Printf("error with generating token")
-		return "", err
+		return nil, err
 	}
-	return token, nil
+	if a.Sessions.IsRevoked(claims.Jti) {
+		return nil, auth.ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+func (a *API) SignUp(ctx context.Context, username, password string) error {
+	_, err := a.Users.SignUp(ctx, username, password)
+	return err
 }
 
-func (a *API) ValidateToken(token string) bool {
-	if _, err := auth.ValidateToken(token); err != nil {
-		return false
+// Login выдает пару токенов только после успешной проверки пароля
+func (a *API) Login(ctx context.Context, username, password string) (auth.TokenPair, error) {
+	user, err := a.Users.Authenticate(ctx, username, password)
+	if err != nil {
+		return auth.TokenPair{}, err
 	}
-	return true
+	return a.Sessions.Issue(auth.Principal{Username: user.Username, Roles: user.Roles})
+}
+
+func (a *API) RefreshToken(refreshToken string) (auth.TokenPair, error) {
+	return a.Sessions.Refresh(refreshToken)
+}
+
+// RevokeToken завершает сессию: отзывает семью refresh токена и, если
+// передан, текущий access токен
+func (a *API) RevokeToken(refreshToken, accessToken string) error {
+	if accessToken != "" {
+		if claims, err := a.Tokens.ValidateToken(accessToken); err == nil {
+			a.Sessions.RevokeAccess(claims)
+		}
+	}
+	return a.Sessions.Revoke(refreshToken)
+}
+
+func (a *API) JWKS() auth.JWKS {
+	return a.Tokens.JWKS()
 }
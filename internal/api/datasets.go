@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/places"
+)
+
+type JobStatus string
+
+const (
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// ImportJob фоновая загрузка датасета, запущенная через админское API
+type ImportJob struct {
+	ID         string             `json:"id"`
+	Status     JobStatus          `json:"status"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	Report     places.ImportStats `json:"report"`
+	report     *places.ImportReport
+}
+
+// jobRetention сколько хранится завершенная задача, потом она удаляется
+const jobRetention = 24 * time.Hour
+
+// ErrImportRunning в индекс уже идет загрузка, вторая параллельная загрузка
+// перемешала бы отчеты и нагрузку на эластик
+var ErrImportRunning = errors.New("another import is running")
+
+type jobRegistry struct {
+	mu   sync.RWMutex
+	jobs map[string]*ImportJob
+	// выполняющаяся задача и отмена ее контекста, nil если загрузки нет
+	running *ImportJob
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*ImportJob)}
+}
+
+// prune удаляет задачи, завершенные раньше jobRetention. Вызывается под mu
+func (r *jobRegistry) prune(now time.Time) {
+	for id, job := range r.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > jobRetention {
+			delete(r.jobs, id)
+		}
+	}
+}
+
+// ImportDataset сохраняет содержимое r во временный файл и запускает его
+// загрузку в стор в отдельной горутине. Прогресс доступен через GetImportJob.
+// Загрузка продолжается после завершения запроса ctx, но остается в его трейсе.
+// Одновременно идет только одна загрузка: пока она не закончится, возвращается
+// ErrImportRunning вместе с выполняющейся задачей. До готовности сервиса идет
+// загрузка датасета при старте, поэтому возвращается ErrNotReady
+func (a *API) ImportDataset(ctx context.Context, r io.Reader, opts places.ImportOptions) (ImportJob, error) {
+	if !a.IndexLoaded() {
+		return ImportJob{}, ErrNotReady
+	}
+	a.jobs.mu.RLock()
+	running := a.jobs.running
+	a.jobs.mu.RUnlock()
+	if running != nil {
+		return a.snapshotJob(running), ErrImportRunning
+	}
+
+	tmp, err := os.CreateTemp("", "dataset-*.csv")
+	if err != nil {
+		return ImportJob{}, err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return ImportJob{}, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return ImportJob{}, err
+	}
+
+	job := &ImportJob{
+		ID:        newJobID(),
+		Status:    JobStatusRunning,
+		StartedAt: time.Now(),
+		report:    places.NewImportReport(),
+	}
+	// остановка сервиса отменяет загрузку между батчами
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	a.jobs.mu.Lock()
+	// файл мог загружаться долго, за это время могла начаться другая загрузка
+	if running := a.jobs.running; running != nil {
+		a.jobs.mu.Unlock()
+		cancel()
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return a.snapshotJob(running), ErrImportRunning
+	}
+	a.jobs.prune(job.StartedAt)
+	a.jobs.jobs[job.ID] = job
+	a.jobs.running, a.jobs.cancel = job, cancel
+	a.jobs.wg.Add(1)
+	a.jobs.mu.Unlock()
+
+	go func() {
+		defer a.jobs.wg.Done()
+		defer cancel()
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		err := a.Store.IndexPlaces(jobCtx, tmp, opts, job.report)
+
+		a.jobs.mu.Lock()
+		defer a.jobs.mu.Unlock()
+		a.jobs.running, a.jobs.cancel = nil, nil
+		now := time.Now()
+		job.FinishedAt = &now
+		if err != nil {
+			slog.ErrorContext(jobCtx, "import job failed", "job_id", job.ID, "err", err)
+			job.Status = JobStatusFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = JobStatusCompleted
+	}()
+
+	return a.snapshotJob(job), nil
+}
+
+// StopImports отменяет выполняющуюся загрузку и ждет, пока она отправит
+// начатые батчи и сохранит отчет
+func (a *API) StopImports() {
+	a.jobs.mu.Lock()
+	if a.jobs.cancel != nil {
+		a.jobs.cancel()
+	}
+	a.jobs.mu.Unlock()
+	a.jobs.wg.Wait()
+}
+
+func (a *API) GetImportJob(id string) (ImportJob, bool) {
+	a.jobs.mu.RLock()
+	job, ok := a.jobs.jobs[id]
+	a.jobs.mu.RUnlock()
+	if !ok {
+		return ImportJob{}, false
+	}
+	return a.snapshotJob(job), true
+}
+
+func (a *API) snapshotJob(job *ImportJob) ImportJob {
+	a.jobs.mu.RLock()
+	defer a.jobs.mu.RUnlock()
+	res := *job
+	res.Report = job.report.Stats()
+	res.report = nil
+	return res
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
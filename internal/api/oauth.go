@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+
+	"github.com/zkhrg/go_day03/internal/auth"
+)
+
+func (a *API) RegisterOAuthClient(c auth.Client) (auth.Client, string, error) {
+	return a.OAuth.RegisterClient(c)
+}
+
+func (a *API) ListOAuthClients() []auth.Client {
+	return a.OAuth.Clients()
+}
+
+func (a *API) DeleteOAuthClient(id string) error {
+	return a.OAuth.DeleteClient(id)
+}
+
+func (a *API) CheckAuthorization(req *auth.AuthorizationRequest) (auth.Client, error) {
+	return a.OAuth.CheckAuthorization(req)
+}
+
+// AuthorizeUser проверяет пароль пользователя на форме входа и выдает
+// клиенту код авторизации
+func (a *API) AuthorizeUser(ctx context.Context, req auth.AuthorizationRequest, username, password string) (string, error) {
+	user, err := a.Users.Authenticate(ctx, username, password)
+	if err != nil {
+		return "", err
+	}
+	return a.OAuth.Authorize(req, user)
+}
+
+func (a *API) OAuthToken(req auth.TokenRequest) (auth.TokenResponse, error) {
+	return a.OAuth.Token(req)
+}
+
+func (a *API) Introspect(clientID, clientSecret, token string) (auth.Introspection, error) {
+	return a.OAuth.Introspect(clientID, clientSecret, token)
+}
@@ -2,7 +2,6 @@ package api
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/zkhrg/go_day03/internal/places"
 )
@@ -16,13 +15,14 @@ type Page struct {
 	LastPage int            `json:"last_page"`
 }
 
-func (a *API) GetPage(ctx context.Context, pageNumber int, pageSize int) (Page, error) {
+// GetPage собирает страницу мест. total уже посчитан вызывающим, чтобы
+// не ходить за ним в хранилище повторно
+func (a *API) GetPage(ctx context.Context, pageNumber int, pageSize int, total int) (Page, error) {
 	// дергает метод из строа и просто его возвращает
-	places, err := a.Store.GetPlacesByPageParams(ctx, pageNumber, pageSize)
+	places, err := a.Store.GetPlacesByPageParams(ctx, pageNumber, pageSize, total)
 	if err != nil {
-		fmt.Println("hanling error at getpage")
+		return Page{}, err
 	}
-	total := a.Store.GetTotalRecords()
 	return Page{
 		Places:   places,
 		Total:    total,
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/pkg/jsonfile"
+)
+
+const apiKeyPrefix = "gd3_"
+
+var (
+	ErrInvalidAPIKey   = errors.New("invalid API key")
+	ErrAPIKeyExpired   = errors.New("API key expired")
+	ErrAPIKeyNotFound  = errors.New("API key not found")
+	ErrUnknownScope    = errors.New("unknown scope")
+	ErrInvalidKeyName  = errors.New("API key name must not be empty")
+	ErrExpiryInThePast = errors.New("API key expiry must be in the future")
+)
+
+// APIKey ключ машинного клиента. Сам ключ показывается только при создании,
+// хранится лишь его хэш
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// первые символы ключа, чтобы его можно было узнать в списке
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	UsageCount int64      `json:"usage_count"`
+}
+
+// apiKeyRecord то, что лежит в файле: ключ вместе с хэшем
+type apiKeyRecord struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+// APIKeys хранит ключи в памяти и в json файле. Создание и отзыв пишутся
+// сразу, счетчики использования сбрасываются на диск периодически через
+// FlushEvery, чтобы не переписывать файл на каждый запрос
+type APIKeys struct {
+	mu     sync.Mutex
+	path   string
+	byID   map[string]*apiKeyRecord
+	byHash map[string]*apiKeyRecord
+	dirty  bool
+}
+
+func NewAPIKeys(path string) (*APIKeys, error) {
+	k := &APIKeys{
+		path:   path,
+		byID:   make(map[string]*apiKeyRecord),
+		byHash: make(map[string]*apiKeyRecord),
+	}
+	var records []*apiKeyRecord
+	if err := jsonfile.Load(path, &records); err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		k.byID[rec.ID] = rec
+		k.byHash[rec.Hash] = rec
+	}
+	return k, nil
+}
+
+// Create выпускает новый ключ и возвращает его описание и сам ключ.
+// Без scopes ключ получает права обычного пользователя
+func (k *APIKeys) Create(name string, scopes []string, expiresAt *time.Time, createdBy string) (APIKey, string, error) {
+	if name == "" {
+		return APIKey{}, "", ErrInvalidKeyName
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return APIKey{}, "", ErrExpiryInThePast
+	}
+	if len(scopes) == 0 {
+		scopes = ScopesForRoles([]string{RoleUser})
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(KnownScopes, scope) {
+			return APIKey{}, "", fmt.Errorf("%w %q", ErrUnknownScope, scope)
+		}
+	}
+
+	secret := apiKeyPrefix + randomID() + randomID()
+	rec := &apiKeyRecord{
+		APIKey: APIKey{
+			ID:        randomID(),
+			Name:      name,
+			Prefix:    secret[:len(apiKeyPrefix)+6],
+			Scopes:    slices.Clone(scopes),
+			CreatedBy: createdBy,
+			CreatedAt: time.Now().UTC(),
+			ExpiresAt: expiresAt,
+		},
+		Hash: hashToken(secret),
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.byID[rec.ID] = rec
+	k.byHash[rec.Hash] = rec
+	if err := k.save(); err != nil {
+		delete(k.byID, rec.ID)
+		delete(k.byHash, rec.Hash)
+		return APIKey{}, "", err
+	}
+	return rec.APIKey, secret, nil
+}
+
+// List все ключи, включая отозванные, от новых к старым
+func (k *APIKeys) List() []APIKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	res := make([]APIKey, 0, len(k.byID))
+	for _, rec := range k.byID {
+		res = append(res, rec.APIKey)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.After(res[j].CreatedAt)
+	})
+	return res
+}
+
+// Revoke отзывает ключ. Запись остается в списке, чтобы была видна история
+func (k *APIKeys) Revoke(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	rec, ok := k.byID[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	if rec.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	rec.RevokedAt = &now
+	if err := k.save(); err != nil {
+		rec.RevokedAt = nil
+		return err
+	}
+	return nil
+}
+
+// Authenticate находит ключ по значению и отмечает его использование
+func (k *APIKeys) Authenticate(secret string) (APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	rec, ok := k.byHash[hashToken(secret)]
+	if !ok || rec.RevokedAt != nil {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	now := time.Now().UTC()
+	if rec.ExpiresAt != nil && now.After(*rec.ExpiresAt) {
+		return APIKey{}, ErrAPIKeyExpired
+	}
+	rec.LastUsedAt = &now
+	rec.UsageCount++
+	k.dirty = true
+	return rec.APIKey, nil
+}
+
+// Principal от чьего имени работает запрос с этим ключом
+func (key APIKey) Principal() Principal {
+	return Principal{Username: "apikey:" + key.ID, Scopes: key.Scopes, APIKeyID: key.ID}
+}
+
+// FlushEvery сохраняет накопленные счетчики использования раз в interval
+// и при отмене ctx
+func (k *APIKeys) FlushEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			k.flush()
+			return
+		case <-ticker.C:
+			k.flush()
+		}
+	}
+}
+
+func (k *APIKeys) flush() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.dirty {
+		return
+	}
+	if err := k.save(); err != nil {
+		slog.Error("cannot save api keys usage", "err", err)
+	}
+}
+
+func (k *APIKeys) save() error {
+	records := make([]*apiKeyRecord, 0, len(k.byID))
+	for _, rec := range k.byID {
+		records = append(records, rec)
+	}
+	if err := jsonfile.Save(k.path, records); err != nil {
+		return err
+	}
+	k.dirty = false
+	return nil
+}
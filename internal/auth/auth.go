@@ -1,92 +1,258 @@
 package auth
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 )
 
-const jwtKey = "extremly secure jwt key!"
-
 type JWTHeader struct {
 	Alg string `json:"alg"`
 	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
 }
 
 type JWTClaims struct {
-	Username string `json:"username"`
-	Exp      int64  `json:"exp"`
+	Username string   `json:"username"`
+	Issuer   string   `json:"iss,omitempty"`
+	Subject  string   `json:"sub,omitempty"`
+	Audience Audience `json:"aud,omitempty"`
+	Exp      int64    `json:"exp"`
+	Nbf      int64    `json:"nbf,omitempty"`
+	Iat      int64    `json:"iat,omitempty"`
+	Jti      string   `json:"jti,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	// scope через пробел, как в OAuth 2.0
+	Scope string `json:"scope,omitempty"`
+	// клиент OAuth, которому выдан токен (RFC 9068)
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// Audience claim aud, по RFC 7519 это строка или массив строк
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+const (
+	defaultAccessTTL = 15 * time.Minute
+	defaultLeeway    = 30 * time.Second
+)
+
+// TokensConfig настройки выдачи и проверки токенов
+type TokensConfig struct {
+	// алгоритмы, с которыми принимаются токены, пусто - все SupportedAlgs
+	AllowedAlgs []string
+	// время жизни access токена, 0 - 15 минут
+	AccessTTL time.Duration
+	// iss выдаваемых токенов, проверяется у входящих если не пустой
+	Issuer string
+	// aud выдаваемых токенов, входящий токен должен содержать его среди своих aud
+	Audience string
+	// допустимое расхождение часов при проверке exp, nbf и iat, 0 - 30 секунд
+	Leeway time.Duration
 }
 
-func GetTokenByName(username string) (string, error) {
+// Tokens выдает и проверяет JWT, ключи берутся из KeyStore на каждый вызов,
+// так что перезагрузка ключей сразу влияет на новые токены
+type Tokens struct {
+	keys *KeyStore
+	// алгоритмы, токены с которыми вообще принимаются к проверке
+	allowedAlgs map[string]bool
+	accessTTL   time.Duration
+	issuer      string
+	audience    string
+	leeway      time.Duration
+}
+
+func NewTokens(keys *KeyStore, cfg TokensConfig) (*Tokens, error) {
+	allowedAlgs := cfg.AllowedAlgs
+	if len(allowedAlgs) == 0 {
+		allowedAlgs = SupportedAlgs
+	}
+	t := &Tokens{
+		keys:        keys,
+		allowedAlgs: make(map[string]bool),
+		accessTTL:   cfg.AccessTTL,
+		issuer:      cfg.Issuer,
+		audience:    cfg.Audience,
+		leeway:      cfg.Leeway,
+	}
+	if t.accessTTL <= 0 {
+		t.accessTTL = defaultAccessTTL
+	}
+	if t.leeway <= 0 {
+		t.leeway = defaultLeeway
+	}
+	for _, alg := range allowedAlgs {
+		if !slices.Contains(SupportedAlgs, alg) {
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedAlg, alg)
+		}
+		t.allowedAlgs[alg] = true
+	}
+	return t, nil
+}
+
+// JWKS публичные ключи для проверки токенов сторонними сервисами
+func (t *Tokens) JWKS() JWKS {
+	return t.keys.JWKS()
+}
+
+// newAccessToken подписывает access токен и возвращает его вместе с claims,
+// чтобы вызывающий мог запомнить jti и срок жизни
+func (t *Tokens) newAccessToken(p Principal) (string, *JWTClaims, error) {
+	key := t.keys.primary()
+
 	// Создание заголовка JWT
 	header := JWTHeader{
-		Alg: "HS256",
+		Alg: key.Alg,
 		Typ: "JWT",
+		Kid: key.ID,
 	}
 	headerBytes, err := json.Marshal(header)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	headerEncoded := base64Encode(headerBytes)
 
+	now := time.Now()
 	claims := JWTClaims{
-		Username: username,
-		Exp:      time.Now().Add(15 * time.Minute).Unix(),
+		Username: p.Username,
+		Issuer:   t.issuer,
+		Subject:  p.Username,
+		Exp:      now.Add(t.accessTTL).Unix(),
+		Nbf:      now.Unix(),
+		Iat:      now.Unix(),
+		Jti:      randomID(),
+		Roles:    p.Roles,
+		Scope:    strings.Join(p.scopes(), " "),
+		ClientID: p.ClientID,
+	}
+	if t.audience != "" {
+		claims.Audience = Audience{t.audience}
 	}
 	claimsBytes, err := json.Marshal(claims)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	claimsEncoded := base64Encode(claimsBytes)
 
 	unsignedToken := fmt.Sprintf("%s.%s", headerEncoded, claimsEncoded)
-
-	h := hmac.New(sha256.New, []byte(jwtKey))
-	h.Write([]byte(unsignedToken))
-	signature := base64Encode(h.Sum(nil))
+	signatureBytes, err := signWith(key, unsignedToken)
+	if err != nil {
+		return "", nil, err
+	}
+	signature := base64Encode(signatureBytes)
 
 	token := fmt.Sprintf("%s.%s", unsignedToken, signature)
-	return token, nil
+	return token, &claims, nil
 }
 
-func ValidateToken(token string) (*JWTClaims, error) {
+// ValidateToken проверяет заголовок, подпись и зарегистрированные claims.
+// Все ошибки проверки имеют тип *TokenError
+func (t *Tokens) ValidateToken(token string) (*JWTClaims, error) {
 	parts := strings.Split(token, ".")
 	if len(parts) != 3 {
-		return nil, errors.New("invalid token format")
+		return nil, ErrMalformedToken
 	}
 
-	headerAndClaims := strings.Join(parts[:2], ".")
-	signatureProvided := parts[2]
-
-	h := hmac.New(sha256.New, []byte(jwtKey))
-	h.Write([]byte(headerAndClaims))
-	signatureExpected := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+	var header JWTHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if header.Typ != "" && !strings.EqualFold(header.Typ, "JWT") {
+		return nil, ErrInvalidTyp
+	}
+	if !t.allowedAlgs[header.Alg] {
+		return nil, ErrUnsupportedAlg
+	}
 
-	if signatureProvided != signatureExpected {
-		return nil, errors.New("invalid token signature")
+	key, err := t.keys.get(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	// alg из заголовка обязан совпадать с алгоритмом ключа, иначе можно
+	// подписать HS256 публичным RSA ключом как секретом
+	if header.Alg != key.Alg {
+		return nil, ErrUnsupportedAlg
 	}
 
-	claimsBytes, err := base64Decode(parts[1])
+	headerAndClaims := strings.Join(parts[:2], ".")
+	signatureProvided, err := base64Decode(parts[2])
 	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if err := verifyWith(key, headerAndClaims, signatureProvided); err != nil {
 		return nil, err
 	}
 
 	var claims JWTClaims
-	if err := json.Unmarshal(claimsBytes, &claims); err != nil {
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if err := t.validateClaims(&claims); err != nil {
 		return nil, err
 	}
 
-	if time.Now().Unix() > claims.Exp {
-		return nil, errors.New("token expired")
+	return &claims, nil
+}
+
+func (t *Tokens) validateClaims(claims *JWTClaims) error {
+	now := time.Now()
+	leeway := int64(t.leeway.Seconds())
+
+	switch {
+	case claims.Exp == 0 || now.Unix() > claims.Exp+leeway:
+		return ErrTokenExpired
+	case claims.Nbf != 0 && now.Unix() < claims.Nbf-leeway:
+		return ErrTokenNotYetValid
+	case claims.Iat != 0 && now.Unix() < claims.Iat-leeway:
+		return ErrTokenIssuedLater
+	case t.issuer != "" && claims.Issuer != t.issuer:
+		return ErrInvalidIssuer
+	case t.audience != "" && !slices.Contains(claims.Audience, t.audience):
+		return ErrInvalidAudience
+	case claims.Jti == "":
+		return ErrMissingJTI
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64Decode(segment)
+	if err != nil {
+		return err
 	}
+	return json.Unmarshal(data, v)
+}
 
-	return &claims, nil
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64Encode(b)
 }
 
 func base64Decode(data string) ([]byte, error) {
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// testKey генерирует ключ подписи для алгоритма alg
+func testKey(t *testing.T, kid, alg string) Key {
+	t.Helper()
+	k := Key{ID: kid, Alg: alg}
+	var err error
+	switch alg {
+	case AlgHS256:
+		k.Secret = testSecret
+		return k
+	case AlgRS256:
+		k.Private, err = rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	case AlgES256:
+		k.Private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, k.Private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Public = k.Private.Public()
+	return k
+}
+
+// keySet набор ключей, первый ключ подписывает новые токены
+func keySet(keys ...Key) *KeySet {
+	set := &KeySet{Primary: keys[0].ID, Keys: make(map[string]Key)}
+	for _, k := range keys {
+		set.Keys[k.ID] = k
+	}
+	return set
+}
+
+// newTestTokens токены с ключами из load
+func newTestTokens(t *testing.T, load KeyLoader) *Tokens {
+	t.Helper()
+	store, err := NewKeyStore(load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := NewTokens(store, TokensConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+// staticKeys загрузчик неизменного набора ключей
+func staticKeys(keys ...Key) KeyLoader {
+	set := keySet(keys...)
+	return func() (*KeySet, error) { return set, nil }
+}
+
+// forgeToken собирает JWT с произвольным заголовком, как это сделал бы атакующий
+func forgeToken(t *testing.T, header JWTHeader, sign func(data string) []byte) string {
+	t.Helper()
+	now := time.Now()
+	headerBytes, _ := json.Marshal(header)
+	claimsBytes, _ := json.Marshal(JWTClaims{
+		Username: "mallory",
+		Exp:      now.Add(time.Minute).Unix(),
+		Iat:      now.Unix(),
+		Jti:      randomID(),
+		Roles:    []string{RoleAdmin},
+	})
+	data := base64Encode(headerBytes) + "." + base64Encode(claimsBytes)
+	return data + "." + base64Encode(sign(data))
+}
+
+func TestSignVerify(t *testing.T) {
+	for _, alg := range SupportedAlgs {
+		t.Run(alg, func(t *testing.T) {
+			k := testKey(t, "k1", alg)
+			if err := checkKeyMaterial(k); err != nil {
+				t.Fatal(err)
+			}
+			sig, err := signWith(k, "header.claims")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifyWith(k, "header.claims", sig); err != nil {
+				t.Errorf("verify own signature: %v", err)
+			}
+			if err := verifyWith(k, "header.claimz", sig); !errors.Is(err, ErrInvalidSig) {
+				t.Errorf("verify changed data: error = %v, want ErrInvalidSig", err)
+			}
+			other := testKey(t, "k2", alg)
+			if alg == AlgHS256 {
+				other.Secret = []byte("another secret of thirty-two byte")
+			}
+			if err := verifyWith(other, "header.claims", sig); !errors.Is(err, ErrInvalidSig) {
+				t.Errorf("verify with other key: error = %v, want ErrInvalidSig", err)
+			}
+
+			tokens := newTestTokens(t, staticKeys(k))
+			token, _, err := tokens.newAccessToken(Principal{Username: "bob", Roles: []string{RoleUser}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := tokens.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			if claims.Username != "bob" || !claims.HasScope(ScopePlacesRead) {
+				t.Errorf("ValidateToken() claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejects(t *testing.T) {
+	rsaKey := testKey(t, "rsa", AlgRS256)
+	tokens := newTestTokens(t, staticKeys(rsaKey))
+	publicDER, err := x509.MarshalPKIXPublicKey(rsaKey.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	valid, _, err := tokens.newAccessToken(Principal{Username: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	validSig, err := base64Decode(strings.Split(valid, ".")[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{
+			name:    "alg none",
+			token:   forgeToken(t, JWTHeader{Alg: "none", Typ: "JWT", Kid: "rsa"}, func(string) []byte { return nil }),
+			wantErr: ErrUnsupportedAlg,
+		},
+		{
+			name:    "alg none without kid",
+			token:   forgeToken(t, JWTHeader{Alg: "none", Typ: "JWT"}, func(string) []byte { return nil }),
+			wantErr: ErrUnsupportedAlg,
+		},
+		{
+			// публичный ключ RSA известен всем, им нельзя подписать HS256
+			name: "hs256 signed with rsa public key",
+			token: forgeToken(t, JWTHeader{Alg: AlgHS256, Typ: "JWT", Kid: "rsa"}, func(data string) []byte {
+				return hmacSHA256(publicPEM, data)
+			}),
+			wantErr: ErrUnsupportedAlg,
+		},
+		{
+			name: "hs256 signed with rsa public key without kid",
+			token: forgeToken(t, JWTHeader{Alg: AlgHS256, Typ: "JWT"}, func(data string) []byte {
+				return hmacSHA256(publicDER, data)
+			}),
+			wantErr: ErrUnsupportedAlg,
+		},
+		{
+			name:    "unknown kid",
+			token:   forgeToken(t, JWTHeader{Alg: AlgRS256, Typ: "JWT", Kid: "nope"}, func(string) []byte { return []byte("sig") }),
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "wrong typ",
+			token:   forgeToken(t, JWTHeader{Alg: AlgRS256, Typ: "at+jwt", Kid: "rsa"}, func(string) []byte { return []byte("sig") }),
+			wantErr: ErrInvalidTyp,
+		},
+		{
+			name:    "signature of another token",
+			token:   forgeToken(t, JWTHeader{Alg: AlgRS256, Typ: "JWT", Kid: "rsa"}, func(string) []byte { return validSig }),
+			wantErr: ErrInvalidSig,
+		},
+		{name: "two segments", token: "a.b", wantErr: ErrMalformedToken},
+		{name: "empty", token: "", wantErr: ErrMalformedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tokens.ValidateToken(tt.token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := testKey(t, "2024-01", AlgES256)
+	newKey := testKey(t, "2024-02", AlgEdDSA)
+	set := keySet(oldKey)
+	tokens := newTestTokens(t, func() (*KeySet, error) { return set, nil })
+
+	oldToken, _, err := tokens.newAccessToken(Principal{Username: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// новый ключ подписывает, старый еще проверяет выданные токены
+	set = keySet(newKey, oldKey)
+	if err := tokens.keys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	newToken, _, err := tokens.newAccessToken(Principal{Username: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header JWTHeader
+	if err := decodeSegment(strings.Split(newToken, ".")[0], &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Kid != newKey.ID || header.Alg != AlgEdDSA {
+		t.Errorf("new token header = %+v, want kid %q", header, newKey.ID)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := tokens.ValidateToken(token); err != nil {
+			t.Errorf("%s token after rotation: %v", name, err)
+		}
+	}
+
+	// старый ключ выведен из набора
+	set = keySet(newKey)
+	if err := tokens.keys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.ValidateToken(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old token after key removal: error = %v, want ErrUnknownKey", err)
+	}
+	if _, err := tokens.ValidateToken(newToken); err != nil {
+		t.Errorf("new token after key removal: %v", err)
+	}
+
+	// некорректный набор не подменяет действующий
+	set = keySet(newKey)
+	set.Primary = "missing"
+	if err := tokens.keys.Reload(); err == nil {
+		t.Error("Reload() with missing primary key succeeded")
+	}
+	if _, err := tokens.ValidateToken(newToken); err != nil {
+		t.Errorf("new token after failed reload: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+// TokenError ошибка проверки токена. Code соответствует коду ошибки из
+// RFC 6750 для заголовка WWW-Authenticate, Description уходит клиенту
+type TokenError struct {
+	Code        string
+	Description string
+}
+
+func (e *TokenError) Error() string {
+	return e.Description
+}
+
+func invalidToken(description string) *TokenError {
+	return &TokenError{Code: "invalid_token", Description: description}
+}
+
+// Каждая причина отказа отдельным значением, сравнивать через errors.Is
+var (
+	ErrMalformedToken   = invalidToken("token is malformed")
+	ErrInvalidTyp       = invalidToken("token type must be JWT")
+	ErrUnsupportedAlg   = invalidToken("unsupported token algorithm")
+	ErrUnknownKey       = invalidToken("unknown signing key")
+	ErrInvalidSig       = invalidToken("invalid token signature")
+	ErrTokenExpired     = invalidToken("token expired")
+	ErrTokenNotYetValid = invalidToken("token is not valid yet")
+	ErrTokenIssuedLater = invalidToken("token is issued in the future")
+	ErrInvalidIssuer    = invalidToken("token issuer is not accepted")
+	ErrInvalidAudience  = invalidToken("token audience is not accepted")
+	ErrMissingJTI       = invalidToken("token has no jti")
+	ErrTokenRevoked     = invalidToken("token is revoked")
+)
+
+// OAuthError ошибка token и authorize эндпоинтов, Code из RFC 6749 раздел 5.2
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+var (
+	ErrOAuthInvalidRequest       = &OAuthError{"invalid_request", "request is missing a required parameter or has an invalid one"}
+	ErrOAuthInvalidClient        = &OAuthError{"invalid_client", "client authentication failed"}
+	ErrOAuthInvalidGrant         = &OAuthError{"invalid_grant", "authorization code or refresh token is invalid, expired or was issued to another client"}
+	ErrOAuthInvalidPKCE          = &OAuthError{"invalid_grant", "code_verifier does not match code_challenge"}
+	ErrOAuthUnauthorizedClient   = &OAuthError{"unauthorized_client", "client is not allowed to use this grant type"}
+	ErrOAuthUnsupportedGrantType = &OAuthError{"unsupported_grant_type", "grant type is not supported"}
+	ErrOAuthUnsupportedResponse  = &OAuthError{"unsupported_response_type", "only response_type=code is supported"}
+	ErrOAuthInvalidScope         = &OAuthError{"invalid_scope", "requested scope is unknown or exceeds the granted scope"}
+	ErrOAuthPKCERequired         = &OAuthError{"invalid_request", "code_challenge with code_challenge_method=S256 is required"}
+	ErrOAuthAccessDenied         = &OAuthError{"access_denied", "resource owner denied the request"}
+	// ErrOAuthInvalidRedirectURI вместе с ErrOAuthInvalidClient нельзя
+	// отдавать редиректом: адрес возврата не подтвержден
+	ErrOAuthInvalidRedirectURI = &OAuthError{"invalid_request", "redirect_uri is not registered for the client"}
+)
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+const minRSAKeyBits = 2048
+
+// SupportedAlgs все алгоритмы, которые умеет подписывать и проверять пакет
+var SupportedAlgs = []string{AlgHS256, AlgRS256, AlgES256, AlgEdDSA}
+
+// signWith подписывает data ключом k по его алгоритму
+func signWith(k Key, data string) ([]byte, error) {
+	switch k.Alg {
+	case AlgHS256:
+		return hmacSHA256(k.Secret, data), nil
+	case AlgRS256:
+		digest := sha256.Sum256([]byte(data))
+		return rsa.SignPKCS1v15(rand.Reader, k.Private.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case AlgES256:
+		digest := sha256.Sum256([]byte(data))
+		r, s, err := ecdsa.Sign(rand.Reader, k.Private.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS требует r и s фиксированной длины подряд, а не ASN.1
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	case AlgEdDSA:
+		return ed25519.Sign(k.Private.(ed25519.PrivateKey), []byte(data)), nil
+	}
+	return nil, ErrUnsupportedAlg
+}
+
+// verifyWith проверяет подпись ключом k. Алгоритм берется из ключа,
+// а не из заголовка токена
+func verifyWith(k Key, data string, sig []byte) error {
+	ok := false
+	switch k.Alg {
+	case AlgHS256:
+		ok = hmac.Equal(sig, hmacSHA256(k.Secret, data))
+	case AlgRS256:
+		digest := sha256.Sum256([]byte(data))
+		ok = rsa.VerifyPKCS1v15(k.Public.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil
+	case AlgES256:
+		if len(sig) == 64 {
+			digest := sha256.Sum256([]byte(data))
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			ok = ecdsa.Verify(k.Public.(*ecdsa.PublicKey), digest[:], r, s)
+		}
+	case AlgEdDSA:
+		ok = ed25519.Verify(k.Public.(ed25519.PublicKey), []byte(data), sig)
+	default:
+		return ErrUnsupportedAlg
+	}
+	if !ok {
+		return ErrInvalidSig
+	}
+	return nil
+}
+
+func hmacSHA256(secret []byte, data string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// checkKeyMaterial убеждается, что тип ключа соответствует алгоритму,
+// иначе подпись упадет с паникой уже на запросе
+func checkKeyMaterial(k Key) error {
+	switch k.Alg {
+	case AlgHS256:
+		if len(k.Secret) < minKeyLength {
+			return fmt.Errorf("key %q must be at least %d bytes long", k.ID, minKeyLength)
+		}
+		return nil
+	case AlgRS256:
+		pub, ok := k.Public.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key %q: %s requires an RSA key", k.ID, k.Alg)
+		}
+		if pub.N.BitLen() < minRSAKeyBits {
+			return fmt.Errorf("key %q: RSA key must be at least %d bits", k.ID, minRSAKeyBits)
+		}
+	case AlgES256:
+		pub, ok := k.Public.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return fmt.Errorf("key %q: %s requires a P-256 key", k.ID, k.Alg)
+		}
+	case AlgEdDSA:
+		if _, ok := k.Public.(ed25519.PublicKey); !ok {
+			return fmt.Errorf("key %q: %s requires an Ed25519 key", k.ID, k.Alg)
+		}
+	default:
+		return fmt.Errorf("key %q: %w %q", k.ID, ErrUnsupportedAlg, k.Alg)
+	}
+	return nil
+}
+
+// parsePrivateKey читает приватный ключ из PEM в форматах PKCS#8, PKCS#1 и SEC 1
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key format")
+}
+
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// JWK публичный ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk публичная часть ключа, для симметричных ключей ok = false,
+// их публиковать нельзя
+func (k Key) jwk() (JWK, bool) {
+	res := JWK{Kid: k.ID, Alg: k.Alg, Use: "sig"}
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		res.Kty = "RSA"
+		res.N = base64Encode(pub.N.Bytes())
+		res.E = base64Encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		res.Kty = "EC"
+		res.Crv = "P-256"
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		res.X = base64Encode(x)
+		res.Y = base64Encode(y)
+	case ed25519.PublicKey:
+		res.Kty = "OKP"
+		res.Crv = "Ed25519"
+		res.X = base64Encode(pub)
+	default:
+		return JWK{}, false
+	}
+	return res, true
+}
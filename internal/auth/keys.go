@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const minKeyLength = 32
+
+// Key ключ подписи токенов, ID попадает в заголовок kid. Для HS256 задан
+// Secret, для асимметричных алгоритмов Public и, если ключ может
+// подписывать, Private
+type Key struct {
+	ID      string
+	Alg     string
+	Secret  []byte
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+func (k Key) canSign() bool {
+	return k.Alg == AlgHS256 || k.Private != nil
+}
+
+// KeySet набор действующих ключей: Primary подписывает новые токены,
+// остальные только проверяют ранее выданные
+type KeySet struct {
+	Primary string
+	Keys    map[string]Key
+}
+
+func (ks *KeySet) primary() Key {
+	return ks.Keys[ks.Primary]
+}
+
+func (ks *KeySet) validate() error {
+	if len(ks.Keys) == 0 {
+		return errors.New("key set is empty")
+	}
+	primary, ok := ks.Keys[ks.Primary]
+	if !ok {
+		return fmt.Errorf("primary key %q is not in key set", ks.Primary)
+	}
+	if !primary.canSign() {
+		return fmt.Errorf("primary key %q has no private key", ks.Primary)
+	}
+	for _, k := range ks.Keys {
+		if err := checkKeyMaterial(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KeyLoader загружает актуальный набор ключей, вызывается при старте
+// и при каждой перезагрузке
+type KeyLoader func() (*KeySet, error)
+
+// KeyStore хранит текущий набор ключей и подменяет его при перезагрузке
+// без остановки сервера
+type KeyStore struct {
+	mu   sync.RWMutex
+	set  *KeySet
+	load KeyLoader
+}
+
+func NewKeyStore(load KeyLoader) (*KeyStore, error) {
+	ks := &KeyStore{load: load}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload загружает ключи заново. Если новый набор некорректен,
+// продолжает работать старый
+func (ks *KeyStore) Reload() error {
+	set, err := ks.load()
+	if err != nil {
+		return err
+	}
+	if err := set.validate(); err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	ks.set = set
+	ks.mu.Unlock()
+	return nil
+}
+
+// ReloadOn перезагружает ключи по сигналу из signals и раз в interval,
+// если он больше нуля. Блокируется до отмены ctx
+func (ks *KeyStore) ReloadOn(ctx context.Context, signals <-chan os.Signal, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		case <-tick:
+		}
+		if err := ks.Reload(); err != nil {
+			slog.Error("cannot reload jwt keys, keeping previous ones", "err", err)
+			continue
+		}
+		slog.Info("jwt keys reloaded")
+	}
+}
+
+func (ks *KeyStore) primary() Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.set.primary()
+}
+
+// JWKS публичные ключи всех асимметричных ключей набора
+func (ks *KeyStore) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	res := JWKS{Keys: []JWK{}}
+	for _, k := range ks.set.Keys {
+		if jwk, ok := k.jwk(); ok {
+			res.Keys = append(res.Keys, jwk)
+		}
+	}
+	sort.Slice(res.Keys, func(i, j int) bool { return res.Keys[i].Kid < res.Keys[j].Kid })
+	return res
+}
+
+func (ks *KeyStore) get(kid string) (Key, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	// токены без kid выданы до появления ротации, проверяем их основным ключом
+	if kid == "" {
+		return ks.set.primary(), nil
+	}
+	k, ok := ks.set.Keys[kid]
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	return k, nil
+}
+
+type keyFileEntry struct {
+	ID             string `json:"kid"`
+	Alg            string `json:"alg"`
+	Secret         string `json:"secret"`
+	PrivateKey     string `json:"private_key"`
+	PrivateKeyFile string `json:"private_key_file"`
+	PublicKey      string `json:"public_key"`
+	PublicKeyFile  string `json:"public_key_file"`
+}
+
+type keyFile struct {
+	Primary string         `json:"primary"`
+	Keys    []keyFileEntry `json:"keys"`
+}
+
+func (e keyFileEntry) key() (Key, error) {
+	k := Key{ID: e.ID, Alg: e.Alg}
+	if k.Alg == "" {
+		k.Alg = AlgHS256
+	}
+	if k.Alg == AlgHS256 {
+		secret, err := base64.StdEncoding.DecodeString(e.Secret)
+		if err != nil {
+			return Key{}, fmt.Errorf("key %q: secret must be base64: %w", e.ID, err)
+		}
+		k.Secret = secret
+		return k, nil
+	}
+
+	privatePEM, err := pemFromField(e.PrivateKey, e.PrivateKeyFile)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %q: %w", e.ID, err)
+	}
+	if privatePEM != nil {
+		k.Private, err = parsePrivateKey(privatePEM)
+		if err != nil {
+			return Key{}, fmt.Errorf("key %q: %w", e.ID, err)
+		}
+		k.Public = k.Private.Public()
+		return k, nil
+	}
+
+	// ключ только для проверки уже выданных токенов
+	publicPEM, err := pemFromField(e.PublicKey, e.PublicKeyFile)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %q: %w", e.ID, err)
+	}
+	if publicPEM == nil {
+		return Key{}, fmt.Errorf("key %q: %s requires private_key or public_key", e.ID, k.Alg)
+	}
+	k.Public, err = parsePublicKey(publicPEM)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %q: %w", e.ID, err)
+	}
+	return k, nil
+}
+
+func pemFromField(inline, path string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	return nil, nil
+}
+
+// FileKeyLoader читает ключи из json файла вида
+//
+//	{"primary": "2024-10", "keys": [
+//	  {"kid": "2024-10", "alg": "ES256", "private_key_file": "/keys/2024-10.pem"},
+//	  {"kid": "2024-09", "alg": "HS256", "secret": "<base64>"}
+//	]}
+//
+// Для асимметричных ключей вместо приватного можно указать только
+// public_key/public_key_file, тогда ключ будет использоваться лишь для проверки
+func FileKeyLoader(path string) KeyLoader {
+	return func() (*KeySet, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var kf keyFile
+		if err := json.Unmarshal(data, &kf); err != nil {
+			return nil, fmt.Errorf("error parsing key file: %w", err)
+		}
+		set := &KeySet{Primary: kf.Primary, Keys: make(map[string]Key, len(kf.Keys))}
+		for _, e := range kf.Keys {
+			k, err := e.key()
+			if err != nil {
+				return nil, err
+			}
+			set.Keys[k.ID] = k
+		}
+		return set, nil
+	}
+}
+
+// StaticKeyLoader один ключ, заданный напрямую в конфиге
+func StaticKeyLoader(kid string, secret []byte) KeyLoader {
+	return func() (*KeySet, error) {
+		return &KeySet{
+			Primary: kid,
+			Keys:    map[string]Key{kid: {ID: kid, Alg: AlgHS256, Secret: secret}},
+		}, nil
+	}
+}
+
+// RandomKeyLoader генерирует ключ один раз при старте. Подходит только
+// для локальной разработки: после перезапуска все токены становятся невалидными
+func RandomKeyLoader() KeyLoader {
+	secret := make([]byte, minKeyLength)
+	rand.Read(secret)
+	return StaticKeyLoader("dev", secret)
+}
@@ -0,0 +1,512 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/pkg/jsonfile"
+)
+
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+
+	// код авторизации живет недолго, клиент обменивает его сразу после редиректа
+	authCodeTTL = time.Minute
+)
+
+var supportedGrants = []string{GrantClientCredentials, GrantAuthorizationCode, GrantRefreshToken}
+
+var (
+	ErrInvalidClientMetadata = errors.New("invalid client metadata")
+	ErrClientNotFound        = errors.New("client not found")
+)
+
+// Client зарегистрированное стороннее приложение
+type Client struct {
+	ID           string   `json:"client_id"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// максимальный набор scope, который может получить клиент
+	Scopes     []string `json:"scopes"`
+	GrantTypes []string `json:"grant_types"`
+	// публичный клиент (SPA, мобильное приложение) не может хранить секрет,
+	// ему доступен только authorization_code с PKCE
+	Public    bool      `json:"public"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type clientRecord struct {
+	Client
+	SecretHash string `json:"secret_hash,omitempty"`
+}
+
+// AuthorizationRequest параметры запроса /oauth/authorize
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest параметры запроса /oauth/token
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+}
+
+// TokenResponse ответ token эндпоинта по RFC 6749
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Introspection ответ эндпоинта интроспекции по RFC 7662
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Nbf       int64    `json:"nbf,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       Audience `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+}
+
+type authCode struct {
+	clientID    string
+	redirectURI string
+	principal   Principal
+	challenge   string
+	exp         time.Time
+
+	// redirect_uri был в запросе на авторизацию, а не подставлен по умолчанию
+	redirectURIProvided bool
+}
+
+// OAuth минимальный сервер авторизации OAuth 2.0: клиенты хранятся в json
+// файле, коды авторизации в памяти. Токены выдаются теми же Tokens и
+// Sessions, что и при обычном входе
+type OAuth struct {
+	tokens   *Tokens
+	sessions *Sessions
+	path     string
+
+	mu      sync.Mutex
+	clients map[string]*clientRecord
+	codes   map[string]*authCode
+}
+
+func NewOAuth(tokens *Tokens, sessions *Sessions, clientsFile string) (*OAuth, error) {
+	o := &OAuth{
+		tokens:   tokens,
+		sessions: sessions,
+		path:     clientsFile,
+		clients:  make(map[string]*clientRecord),
+		codes:    make(map[string]*authCode),
+	}
+	var records []*clientRecord
+	if err := jsonfile.Load(clientsFile, &records); err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		o.clients[rec.ID] = rec
+	}
+	return o, nil
+}
+
+// RegisterClient регистрирует клиента и возвращает его секрет, для
+// публичного клиента секрет пустой. Секрет показывается только здесь
+func (o *OAuth) RegisterClient(c Client) (Client, string, error) {
+	if err := normalizeClient(&c); err != nil {
+		return Client{}, "", err
+	}
+	c.ID = randomID()
+	c.CreatedAt = time.Now().UTC()
+	rec := &clientRecord{Client: c}
+	var secret string
+	if !c.Public {
+		secret = randomID() + randomID()
+		rec.SecretHash = hashToken(secret)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.clients[c.ID] = rec
+	if err := o.save(); err != nil {
+		delete(o.clients, c.ID)
+		return Client{}, "", err
+	}
+	return c, secret, nil
+}
+
+// normalizeClient проверяет метаданные клиента и подставляет значения по умолчанию
+func normalizeClient(c *Client) error {
+	if c.Name == "" {
+		return fmt.Errorf("%w: name must not be empty", ErrInvalidClientMetadata)
+	}
+	if len(c.GrantTypes) == 0 {
+		c.GrantTypes = []string{GrantClientCredentials}
+		if c.Public {
+			c.GrantTypes = []string{GrantAuthorizationCode, GrantRefreshToken}
+		}
+	}
+	for _, grant := range c.GrantTypes {
+		if !slices.Contains(supportedGrants, grant) {
+			return fmt.Errorf("%w: unsupported grant type %q", ErrInvalidClientMetadata, grant)
+		}
+	}
+	if c.Public && slices.Contains(c.GrantTypes, GrantClientCredentials) {
+		return fmt.Errorf("%w: public client can not use client_credentials", ErrInvalidClientMetadata)
+	}
+	if slices.Contains(c.GrantTypes, GrantAuthorizationCode) && len(c.RedirectURIs) == 0 {
+		return fmt.Errorf("%w: authorization_code requires redirect_uris", ErrInvalidClientMetadata)
+	}
+	for _, raw := range c.RedirectURIs {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return fmt.Errorf("%w: redirect uri %q must be an absolute url without fragment", ErrInvalidClientMetadata, raw)
+		}
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = ScopesForRoles([]string{RoleUser})
+	}
+	for _, scope := range c.Scopes {
+		if !slices.Contains(KnownScopes, scope) {
+			return fmt.Errorf("%w: %w %q", ErrInvalidClientMetadata, ErrUnknownScope, scope)
+		}
+	}
+	return nil
+}
+
+// Clients все зарегистрированные клиенты от новых к старым
+func (o *OAuth) Clients() []Client {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	res := make([]Client, 0, len(o.clients))
+	for _, rec := range o.clients {
+		res = append(res, rec.Client)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.After(res[j].CreatedAt)
+	})
+	return res
+}
+
+// DeleteClient удаляет клиента. Уже выданные ему access токены живут до
+// истечения срока, refresh токены перестают обмениваться
+func (o *OAuth) DeleteClient(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rec, ok := o.clients[id]
+	if !ok {
+		return ErrClientNotFound
+	}
+	delete(o.clients, id)
+	if err := o.save(); err != nil {
+		o.clients[id] = rec
+		return err
+	}
+	return nil
+}
+
+// CheckAuthorization проверяет запрос на авторизацию до показа формы входа.
+// Ошибки ErrOAuthInvalidClient и ErrOAuthInvalidRedirectURI показываются
+// пользователю, остальные отправляются клиенту редиректом
+func (o *OAuth) CheckAuthorization(req *AuthorizationRequest) (Client, error) {
+	o.mu.Lock()
+	rec, ok := o.clients[req.ClientID]
+	o.mu.Unlock()
+	if !ok {
+		return Client{}, ErrOAuthInvalidClient
+	}
+	if req.RedirectURI == "" && len(rec.RedirectURIs) == 1 {
+		req.RedirectURI = rec.RedirectURIs[0]
+	}
+	if !slices.Contains(rec.RedirectURIs, req.RedirectURI) {
+		return Client{}, ErrOAuthInvalidRedirectURI
+	}
+	if req.ResponseType != "code" {
+		return rec.Client, ErrOAuthUnsupportedResponse
+	}
+	if !slices.Contains(rec.GrantTypes, GrantAuthorizationCode) {
+		return rec.Client, ErrOAuthUnauthorizedClient
+	}
+	// PKCE обязателен для всех клиентов, метод plain не поддерживается
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return rec.Client, ErrOAuthPKCERequired
+	}
+	if _, err := requestedScopes(req.Scope, rec.Scopes); err != nil {
+		return rec.Client, err
+	}
+	return rec.Client, nil
+}
+
+// Authorize выдает код авторизации пользователю, который вошел на форме.
+// Клиент получает пересечение запрошенных scope и scope пользователя
+func (o *OAuth) Authorize(req AuthorizationRequest, user User) (string, error) {
+	redirectURIProvided := req.RedirectURI != ""
+	client, err := o.CheckAuthorization(&req)
+	if err != nil {
+		return "", err
+	}
+	requested, _ := requestedScopes(req.Scope, client.Scopes)
+	userScopes := ScopesForRoles(user.Roles)
+	var granted []string
+	for _, scope := range requested {
+		if slices.Contains(userScopes, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	if len(granted) == 0 {
+		return "", ErrOAuthAccessDenied
+	}
+
+	code := randomID()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pruneCodes()
+	o.codes[hashToken(code)] = &authCode{
+		clientID:            client.ID,
+		redirectURI:         req.RedirectURI,
+		redirectURIProvided: redirectURIProvided,
+		principal: Principal{
+			Username: user.Username,
+			Roles:    user.Roles,
+			Scopes:   granted,
+			ClientID: client.ID,
+		},
+		challenge: req.CodeChallenge,
+		exp:       time.Now().Add(authCodeTTL),
+	}
+	return code, nil
+}
+
+// Token обрабатывает запрос к token эндпоинту
+func (o *OAuth) Token(req TokenRequest) (TokenResponse, error) {
+	client, err := o.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if !slices.Contains(supportedGrants, req.GrantType) {
+		return TokenResponse{}, ErrOAuthUnsupportedGrantType
+	}
+	if !slices.Contains(client.GrantTypes, req.GrantType) {
+		return TokenResponse{}, ErrOAuthUnauthorizedClient
+	}
+
+	switch req.GrantType {
+	case GrantClientCredentials:
+		return o.clientCredentials(client, req.Scope)
+	case GrantAuthorizationCode:
+		return o.exchangeCode(client, req)
+	default:
+		pair, err := o.sessions.refreshFor(req.RefreshToken, client.ID)
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			return TokenResponse{}, ErrOAuthInvalidGrant
+		}
+		if err != nil {
+			return TokenResponse{}, err
+		}
+		return tokenResponse(pair), nil
+	}
+}
+
+func (o *OAuth) clientCredentials(client Client, scope string) (TokenResponse, error) {
+	scopes, err := requestedScopes(scope, client.Scopes)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	access, claims, err := o.tokens.newAccessToken(Principal{
+		Username: "client:" + client.ID,
+		Scopes:   scopes,
+		ClientID: client.ID,
+	})
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(o.tokens.accessTTL.Seconds()),
+		Scope:       claims.Scope,
+	}, nil
+}
+
+func (o *OAuth) exchangeCode(client Client, req TokenRequest) (TokenResponse, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return TokenResponse{}, ErrOAuthInvalidRequest
+	}
+
+	o.mu.Lock()
+	code, ok := o.codes[hashToken(req.Code)]
+	// код одноразовый, удаляем его даже при неудачной проверке
+	delete(o.codes, hashToken(req.Code))
+	o.mu.Unlock()
+
+	if !ok || time.Now().After(code.exp) || code.clientID != client.ID {
+		return TokenResponse{}, ErrOAuthInvalidGrant
+	}
+	// redirect_uri обязателен при обмене, только если он был в запросе на
+	// авторизацию (RFC 6749 раздел 4.1.3). Переданный без этого адрес
+	// все равно должен совпасть с тем, куда ушел код
+	if (code.redirectURIProvided || req.RedirectURI != "") && req.RedirectURI != code.redirectURI {
+		return TokenResponse{}, ErrOAuthInvalidGrant
+	}
+	if !verifyPKCE(req.CodeVerifier, code.challenge) {
+		return TokenResponse{}, ErrOAuthInvalidPKCE
+	}
+
+	pair, err := o.sessions.Issue(code.principal)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	res := tokenResponse(pair)
+	if !slices.Contains(client.GrantTypes, GrantRefreshToken) {
+		res.RefreshToken = ""
+	}
+	res.Scope = strings.Join(code.principal.Scopes, " ")
+	return res, nil
+}
+
+// Introspect описывает access или refresh токен по RFC 7662. Неизвестный,
+// истекший или отозванный токен описывается как active = false. Вызывать
+// может только конфиденциальный клиент
+func (o *OAuth) Introspect(clientID, clientSecret, token string) (Introspection, error) {
+	client, err := o.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return Introspection{}, err
+	}
+	if client.Public {
+		return Introspection{}, ErrOAuthUnauthorizedClient
+	}
+
+	if claims, err := o.tokens.ValidateToken(token); err == nil {
+		if o.sessions.IsRevoked(claims.Jti) {
+			return Introspection{Active: false}, nil
+		}
+		return Introspection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Username:  claims.Username,
+			TokenType: "Bearer",
+			Exp:       claims.Exp,
+			Iat:       claims.Iat,
+			Nbf:       claims.Nbf,
+			Sub:       claims.Subject,
+			Aud:       claims.Audience,
+			Iss:       claims.Issuer,
+			Jti:       claims.Jti,
+		}, nil
+	}
+
+	if p, exp, ok := o.sessions.lookupRefresh(token); ok {
+		return Introspection{
+			Active:    true,
+			Scope:     strings.Join(p.scopes(), " "),
+			ClientID:  p.ClientID,
+			Username:  p.Username,
+			TokenType: GrantRefreshToken,
+			Exp:       exp.Unix(),
+			Sub:       p.Username,
+		}, nil
+	}
+	return Introspection{Active: false}, nil
+}
+
+// authenticateClient проверяет секрет конфиденциального клиента. Публичный
+// клиент идентифицируется только по client_id
+func (o *OAuth) authenticateClient(id, secret string) (Client, error) {
+	o.mu.Lock()
+	rec, ok := o.clients[id]
+	o.mu.Unlock()
+	if !ok {
+		return Client{}, ErrOAuthInvalidClient
+	}
+	if rec.Public {
+		if secret != "" {
+			return Client{}, ErrOAuthInvalidClient
+		}
+		return rec.Client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(rec.SecretHash)) != 1 {
+		return Client{}, ErrOAuthInvalidClient
+	}
+	return rec.Client, nil
+}
+
+// requestedScopes разбирает scope из запроса, пустой запрос означает все
+// разрешенные клиенту scope
+func requestedScopes(scope string, allowed []string) ([]string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return nil, ErrOAuthInvalidScope
+		}
+	}
+	return requested, nil
+}
+
+// verifyPKCE проверяет code_verifier по методу S256 из RFC 7636
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64Encode(sum[:])), []byte(challenge)) == 1
+}
+
+func tokenResponse(pair TokenPair) TokenResponse {
+	return TokenResponse{
+		AccessToken:  pair.Token,
+		TokenType:    pair.TokenType,
+		ExpiresIn:    pair.ExpiresIn,
+		RefreshToken: pair.RefreshToken,
+	}
+}
+
+func (o *OAuth) pruneCodes() {
+	now := time.Now()
+	for h, code := range o.codes {
+		if now.After(code.exp) {
+			delete(o.codes, h)
+		}
+	}
+}
+
+func (o *OAuth) save() error {
+	records := make([]*clientRecord, 0, len(o.clients))
+	for _, rec := range o.clients {
+		records = append(records, rec)
+	}
+	return jsonfile.Save(o.path, records)
+}
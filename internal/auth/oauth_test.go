@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// пример из RFC 7636 приложение B
+const (
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"rfc example", testVerifier, testChallenge, true},
+		{"other verifier", testVerifier[:42] + "Y", testChallenge, false},
+		{"plain method", testVerifier, testVerifier, false},
+		{"too short", testVerifier[:42], s256(testVerifier[:42]), false},
+		{"too long", strings.Repeat("a", 129), s256(strings.Repeat("a", 129)), false},
+		{"empty challenge", testVerifier, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("verifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64Encode(sum[:])
+}
+
+func TestExchangeCode(t *testing.T) {
+	const callback = "https://app.example/callback"
+	sessions := newTestSessions(t)
+	oauth, err := NewOAuth(sessions.tokens, sessions, filepath.Join(t.TempDir(), "clients.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// единственный адрес клиента подставляется, если redirect_uri не передан
+	client, _, err := oauth.RegisterClient(Client{Name: "spa", Public: true, RedirectURIs: []string{callback}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// redirect_uri запроса на авторизацию
+		authorizeURI string
+		// redirect_uri и code_verifier запроса к token эндпоинту
+		redirectURI string
+		verifier    string
+		wantErr     error
+		// код израсходован и повторно не обменивается
+		consumed bool
+	}{
+		{"valid", callback, callback, testVerifier, nil, true},
+		{"redirect uri omitted in both", "", "", testVerifier, nil, true},
+		{"default redirect uri sent", "", callback, testVerifier, nil, true},
+		// адрес был в запросе на авторизацию, при обмене его нужно передать
+		{"redirect uri omitted", callback, "", testVerifier, ErrOAuthInvalidGrant, true},
+		{"other redirect uri", callback, "https://app.example/other", testVerifier, ErrOAuthInvalidGrant, true},
+		{"other than default redirect uri", "", "https://app.example/other", testVerifier, ErrOAuthInvalidGrant, true},
+		{"pkce mismatch", callback, callback, strings.Repeat("x", 43), ErrOAuthInvalidPKCE, true},
+		{"missing verifier", callback, callback, "", ErrOAuthInvalidRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := oauth.Authorize(AuthorizationRequest{
+				ResponseType:        "code",
+				ClientID:            client.ID,
+				RedirectURI:         tt.authorizeURI,
+				CodeChallenge:       testChallenge,
+				CodeChallengeMethod: "S256",
+			}, User{Username: "bob", Roles: []string{RoleUser}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := TokenRequest{
+				GrantType:    GrantAuthorizationCode,
+				ClientID:     client.ID,
+				Code:         code,
+				RedirectURI:  tt.redirectURI,
+				CodeVerifier: tt.verifier,
+			}
+			res, err := oauth.Token(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Token() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && res.AccessToken == "" {
+				t.Fatal("Token() returned no access token")
+			}
+			// код одноразовый, в том числе после неудачной проверки
+			req.RedirectURI, req.CodeVerifier = callback, testVerifier
+			if _, err := oauth.Token(req); errors.Is(err, ErrOAuthInvalidGrant) != tt.consumed {
+				t.Errorf("second Token() error = %v, code consumed = %v", err, tt.consumed)
+			}
+		})
+	}
+}
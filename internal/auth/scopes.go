@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	ScopePlacesRead  = "places:read"
+	ScopePlacesWrite = "places:write"
+	ScopeAdmin       = "admin"
+)
+
+// KnownScopes все scope, которые можно выдать токену или API ключу
+var KnownScopes = []string{ScopePlacesRead, ScopePlacesWrite, ScopeAdmin}
+
+// roleScopes какие scope получает токен пользователя с ролью
+var roleScopes = map[string][]string{
+	RoleUser:  {ScopePlacesRead},
+	RoleAdmin: {ScopePlacesRead, ScopePlacesWrite, ScopeAdmin},
+}
+
+// Principal от чьего имени выдается токен
+type Principal struct {
+	Username string
+	Roles    []string
+	// явный набор scope, если пусто - выводится из ролей
+	Scopes []string
+	// не пусто, если запрос аутентифицирован API ключом
+	APIKeyID string
+	// не пусто, если токен выдан OAuth клиенту
+	ClientID string
+}
+
+// Key ключ принципала для лимитов и учета использования: key:<id> для API
+// ключа, user:<логин> для пользователя или OAuth клиента
+func (p Principal) Key() string {
+	if p.APIKeyID != "" {
+		return "key:" + p.APIKeyID
+	}
+	return "user:" + p.Username
+}
+
+// HasScope есть ли у принципала scope с учетом его ролей
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.scopes(), scope)
+}
+
+func (p Principal) scopes() []string {
+	if len(p.Scopes) > 0 {
+		return p.Scopes
+	}
+	return ScopesForRoles(p.Roles)
+}
+
+// ScopesForRoles объединение scope всех ролей без повторов
+func ScopesForRoles(roles []string) []string {
+	var scopes []string
+	for _, role := range roles {
+		for _, scope := range roleScopes[role] {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// Scopes список scope из claim scope, который по RFC 8693 хранится строкой
+// через пробел
+func (c *JWTClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *JWTClaims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes(), scope)
+}
+
+// Principal принципал, от имени которого выдан токен
+func (c *JWTClaims) Principal() Principal {
+	return Principal{Username: c.Username, Roles: c.Roles, Scopes: c.Scopes(), ClientID: c.ClientID}
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRefreshTTL = 7 * 24 * time.Hour
+	pruneInterval     = time.Minute
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// предъявлен уже использованный refresh токен: скорее всего он утек,
+	// поэтому отзывается все семейство токенов
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// TokenPair access токен и refresh токен для его обновления
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type refreshRecord struct {
+	family string
+	exp    time.Time
+	used   bool
+}
+
+// family цепочка токенов, начатая одним входом пользователя. Каждое
+// обновление выдает новый refresh токен той же семьи, а старый помечается
+// использованным
+type family struct {
+	principal Principal
+	revoked   bool
+	// jti выданных в семье access токенов и до каких пор их нужно держать
+	// отозванными, чтобы отозвать и их
+	access map[string]time.Time
+	exp    time.Time
+}
+
+// Sessions выдает пары токенов, ротирует refresh токены и ведет список
+// отозванных access токенов по jti. Все хранится в памяти, после
+// перезапуска пользователям нужно войти заново
+type Sessions struct {
+	tokens     *Tokens
+	refreshTTL time.Duration
+
+	mu       sync.Mutex
+	refresh  map[string]*refreshRecord
+	families map[string]*family
+	// jti отозванных access токенов и до каких пор они еще проходят проверку
+	revoked   map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewSessions(tokens *Tokens, refreshTTL time.Duration) *Sessions {
+	if refreshTTL <= 0 {
+		refreshTTL = defaultRefreshTTL
+	}
+	return &Sessions{
+		tokens:     tokens,
+		refreshTTL: refreshTTL,
+		refresh:    make(map[string]*refreshRecord),
+		families:   make(map[string]*family),
+		revoked:    make(map[string]time.Time),
+	}
+}
+
+// Issue начинает новую семью токенов для пользователя. Роли и scope
+// фиксируются на время жизни семьи, новые права вступят в силу после входа
+func (s *Sessions) Issue(p Principal) (TokenPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+
+	familyID := randomID()
+	s.families[familyID] = &family{
+		principal: p,
+		access:    make(map[string]time.Time),
+	}
+	return s.issueInFamily(familyID)
+}
+
+// Refresh обменивает refresh токен на новую пару. Повторное использование
+// токена отзывает всю семью вместе с выданными в ней access токенами
+func (s *Sessions) Refresh(refreshToken string) (TokenPair, error) {
+	return s.refreshFor(refreshToken, "")
+}
+
+// refreshFor обменивает токен, только если семья выдана клиенту clientID:
+// токены OAuth клиентов не обмениваются через обычный вход и наоборот
+func (s *Sessions) refreshFor(refreshToken, clientID string) (TokenPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+
+	rec, ok := s.refresh[hashToken(refreshToken)]
+	if !ok || time.Now().After(rec.exp) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	fam := s.families[rec.family]
+	if fam == nil || fam.revoked || fam.principal.ClientID != clientID {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if rec.used {
+		s.revokeFamily(rec.family)
+		return TokenPair{}, ErrRefreshTokenReused
+	}
+	rec.used = true
+	return s.issueInFamily(rec.family)
+}
+
+// Revoke отзывает семью, к которой относится refresh токен (выход из сессии)
+func (s *Sessions) Revoke(refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.refresh[hashToken(refreshToken)]
+	if !ok {
+		return ErrInvalidRefreshToken
+	}
+	s.revokeFamily(rec.family)
+	return nil
+}
+
+// lookupRefresh принципал и срок действующего refresh токена
+func (s *Sessions) lookupRefresh(refreshToken string) (Principal, time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.refresh[hashToken(refreshToken)]
+	if !ok || rec.used || time.Now().After(rec.exp) {
+		return Principal{}, time.Time{}, false
+	}
+	fam := s.families[rec.family]
+	if fam == nil || fam.revoked {
+		return Principal{}, time.Time{}, false
+	}
+	return fam.principal, rec.exp, true
+}
+
+// RevokeAccess отзывает отдельный access токен до истечения его срока
+func (s *Sessions) RevokeAccess(claims *JWTClaims) {
+	if claims.Jti == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[claims.Jti] = s.validUntil(claims)
+}
+
+// validUntil момент, после которого токен не пройдет проверку сам: срок
+// плюс допуск на расхождение часов. До него отзыв нужно помнить
+func (s *Sessions) validUntil(claims *JWTClaims) time.Time {
+	return time.Unix(claims.Exp, 0).Add(s.tokens.leeway)
+}
+
+func (s *Sessions) IsRevoked(jti string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.revoked[jti]
+	return ok
+}
+
+func (s *Sessions) issueInFamily(familyID string) (TokenPair, error) {
+	fam := s.families[familyID]
+	access, claims, err := s.tokens.newAccessToken(fam.principal)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	fam.access[claims.Jti] = s.validUntil(claims)
+
+	refresh := randomID()
+	exp := time.Now().Add(s.refreshTTL)
+	s.refresh[hashToken(refresh)] = &refreshRecord{family: familyID, exp: exp}
+	fam.exp = exp
+
+	return TokenPair{
+		Token:        access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.tokens.accessTTL.Seconds()),
+	}, nil
+}
+
+func (s *Sessions) revokeFamily(familyID string) {
+	fam := s.families[familyID]
+	if fam == nil {
+		return
+	}
+	fam.revoked = true
+	for jti, until := range fam.access {
+		s.revoked[jti] = until
+	}
+}
+
+// prune удаляет истекшие записи, не чаще раза в pruneInterval
+func (s *Sessions) prune() {
+	now := time.Now()
+	if now.Sub(s.lastPrune) < pruneInterval {
+		return
+	}
+	s.lastPrune = now
+	for h, rec := range s.refresh {
+		if now.After(rec.exp) {
+			delete(s.refresh, h)
+		}
+	}
+	for id, fam := range s.families {
+		if now.After(fam.exp) {
+			delete(s.families, id)
+			continue
+		}
+		for jti, until := range fam.access {
+			if now.After(until) {
+				delete(fam.access, jti)
+			}
+		}
+	}
+	for jti, until := range s.revoked {
+		if now.After(until) {
+			delete(s.revoked, jti)
+		}
+	}
+}
+
+// в памяти храним только хэши, чтобы дамп процесса не раскрыл токены
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
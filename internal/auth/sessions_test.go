@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+// newTestSessions сессии поверх токенов, подписанных одним HS256 ключом
+func newTestSessions(t *testing.T) *Sessions {
+	t.Helper()
+	keys, err := NewKeyStore(StaticKeyLoader("k1", []byte("0123456789abcdef0123456789abcdef")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := NewTokens(keys, TokensConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSessions(tokens, 0)
+}
+
+func TestRefreshRotation(t *testing.T) {
+	sessions := newTestSessions(t)
+	first, err := sessions.Issue(Principal{Username: "bob", Roles: []string{RoleUser}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := sessions.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	third, err := sessions.Refresh(second.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() of rotated token error = %v", err)
+	}
+	// другая семья того же пользователя
+	other, err := sessions.Issue(Principal{Username: "bob", Roles: []string{RoleUser}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// первый токен уже обменян: его предъявление означает утечку
+	if _, err := sessions.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Refresh() of used token error = %v, want ErrRefreshTokenReused", err)
+	}
+
+	tests := []struct {
+		name        string
+		pair        TokenPair
+		wantRevoked bool
+		// ошибка обмена refresh токена после отзыва семьи
+		wantErr error
+	}{
+		{"first", first, true, ErrInvalidRefreshToken},
+		{"second", second, true, ErrInvalidRefreshToken},
+		{"latest", third, true, ErrInvalidRefreshToken},
+		{"other family", other, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := sessions.tokens.ValidateToken(tt.pair.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sessions.IsRevoked(claims.Jti); got != tt.wantRevoked {
+				t.Errorf("access token revoked = %v, want %v", got, tt.wantRevoked)
+			}
+			if _, err := sessions.Refresh(tt.pair.RefreshToken); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Refresh() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefreshClientBinding(t *testing.T) {
+	sessions := newTestSessions(t)
+	tests := []struct {
+		name string
+		// клиент, которому выдана семья, и клиент, который обменивает токен.
+		// Пусто - обычный вход пользователя
+		issuedTo, client string
+		wantErr          error
+	}{
+		{"login", "", "", nil},
+		{"same client", "app", "app", nil},
+		{"client token through login", "app", "", ErrInvalidRefreshToken},
+		{"login token through client", "", "app", ErrInvalidRefreshToken},
+		{"other client", "app", "other", ErrInvalidRefreshToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair, err := sessions.Issue(Principal{Username: "bob", ClientID: tt.issuedTo})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sessions.refreshFor(pair.RefreshToken, tt.client); !errors.Is(err, tt.wantErr) {
+				t.Errorf("refreshFor() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/pkg/jsonfile"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt учитывает только первые 72 байта и отказывается хэшировать длиннее
+	maxPasswordLength = 72
+)
+
+var (
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidUsername    = errors.New("username must be 3-32 characters of latin letters, digits, '.', '_' or '-'")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters long")
+	ErrPasswordTooLong    = errors.New("password must be at most 72 bytes long")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+var usernameRe = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,32}$`)
+
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	Roles        []string  `json:"roles"`
+	CreatedAt    time.Time `json:"created_at"`
+	// аккаунт создан сервером из auth.admin_users, а не регистрацией
+	Provisioned bool `json:"provisioned,omitempty"`
+}
+
+// UserRepository хранилище пользователей, реестру неважно где они лежат
+type UserRepository interface {
+	Create(ctx context.Context, u User) error
+	Get(ctx context.Context, username string) (User, error)
+}
+
+// Registry регистрирует и аутентифицирует пользователей
+type Registry struct {
+	repo UserRepository
+	// хэш для сравнения, когда пользователь не найден, чтобы по времени
+	// ответа нельзя было понять, существует ли логин
+	dummyHash []byte
+	// логины, которые всегда получают роль admin
+	admins map[string]bool
+}
+
+func NewRegistry(repo UserRepository, admins []string) *Registry {
+	dummy, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	r := &Registry{repo: repo, dummyHash: dummy, admins: make(map[string]bool)}
+	for _, a := range admins {
+		r.admins[a] = true
+	}
+	return r
+}
+
+// withConfiguredRoles добавляет роль admin аккаунтам из списка админов.
+// Роль получают только аккаунты, созданные ProvisionAdmins: иначе любой мог
+// бы зарегистрироваться под логином из списка раньше настоящего админа
+func (r *Registry) withConfiguredRoles(u User) User {
+	if u.Provisioned && r.admins[u.Username] && !slices.Contains(u.Roles, RoleAdmin) {
+		u.Roles = append(slices.Clone(u.Roles), RoleAdmin)
+	}
+	return u
+}
+
+// ProvisionAdmins создает недостающие аккаунты админов с хэшем пароля
+// passwordHash. Уже созданные аккаунты не меняются
+func (r *Registry) ProvisionAdmins(ctx context.Context, passwordHash string) error {
+	for username := range r.admins {
+		u, err := r.repo.Get(ctx, username)
+		if err == nil {
+			if !u.Provisioned {
+				slog.WarnContext(ctx, "admin username is taken by a signed up account, it does not get the admin role",
+					"username", username)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+		err = r.repo.Create(ctx, User{
+			Username:     username,
+			PasswordHash: passwordHash,
+			Roles:        []string{RoleUser},
+			CreatedAt:    time.Now().UTC(),
+			Provisioned:  true,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot create admin %s: %w", username, err)
+		}
+		slog.InfoContext(ctx, "admin account created", "username", username)
+	}
+	return nil
+}
+
+func (r *Registry) SignUp(ctx context.Context, username, password string) (User, error) {
+	if !usernameRe.MatchString(username) {
+		return User{}, ErrInvalidUsername
+	}
+	// логины админов заняты, даже если аккаунт еще не создан
+	if r.admins[username] {
+		return User{}, ErrUserExists
+	}
+	if len(password) < minPasswordLength {
+		return User{}, ErrWeakPassword
+	}
+	if len(password) > maxPasswordLength {
+		return User{}, ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+	u := r.withConfiguredRoles(User{
+		Username:     username,
+		PasswordHash: string(hash),
+		Roles:        []string{RoleUser},
+		CreatedAt:    time.Now().UTC(),
+	})
+	if err := r.repo.Create(ctx, u); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// Authenticate проверяет пароль пользователя. Для неизвестного логина
+// и неверного пароля возвращается одна и та же ErrInvalidCredentials
+func (r *Registry) Authenticate(ctx context.Context, username, password string) (User, error) {
+	u, err := r.repo.Get(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword(r.dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return r.withConfiguredRoles(u), nil
+}
+
+// FileUserRepository держит пользователей в памяти и целиком переписывает
+// json файл при каждом изменении. Для десятков и сотен пользователей этого хватает
+type FileUserRepository struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]User
+}
+
+func NewFileUserRepository(path string) (*FileUserRepository, error) {
+	repo := &FileUserRepository{
+		path:  path,
+		users: make(map[string]User),
+	}
+	var users []User
+	if err := jsonfile.Load(path, &users); err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		repo.users[u.Username] = u
+	}
+	return repo, nil
+}
+
+func (repo *FileUserRepository) Create(ctx context.Context, u User) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if _, ok := repo.users[u.Username]; ok {
+		return ErrUserExists
+	}
+	repo.users[u.Username] = u
+	if err := repo.save(); err != nil {
+		delete(repo.users, u.Username)
+		return err
+	}
+	return nil
+}
+
+func (repo *FileUserRepository) Get(ctx context.Context, username string) (User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	u, ok := repo.users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (repo *FileUserRepository) save() error {
+	users := make([]User, 0, len(repo.users))
+	for _, u := range repo.users {
+		users = append(users, u)
+	}
+	return jsonfile.Save(repo.path, users)
+}
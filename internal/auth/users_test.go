@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSignUpValidation(t *testing.T) {
+	repo, err := NewFileUserRepository(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry(repo, nil)
+	tests := []struct {
+		username string
+		password string
+		wantErr  error
+	}{
+		{"bob", "Passw0rd!", nil},
+		{"bob", "Passw0rd!", ErrUserExists},
+		{"b", "Passw0rd!", ErrInvalidUsername},
+		{"alice", "short", ErrWeakPassword},
+		{"alice", strings.Repeat("a", maxPasswordLength), nil},
+		{"carol", strings.Repeat("a", maxPasswordLength+1), ErrPasswordTooLong},
+		// 37 кириллических букв это 74 байта
+		{"carol", strings.Repeat("я", 37), ErrPasswordTooLong},
+	}
+	for _, tt := range tests {
+		if _, err := registry.SignUp(context.Background(), tt.username, tt.password); !errors.Is(err, tt.wantErr) {
+			t.Errorf("SignUp(%q, %d bytes) error = %v, want %v", tt.username, len(tt.password), err, tt.wantErr)
+		}
+	}
+	if _, err := registry.Authenticate(context.Background(), "alice", strings.Repeat("a", maxPasswordLength)); err != nil {
+		t.Errorf("Authenticate() error = %v", err)
+	}
+}
+
+func TestAdminRoles(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewFileUserRepository(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// alice зарегистрировалась до того, как ее логин попал в список админов
+	if _, err := NewRegistry(repo, nil).SignUp(ctx, "alice", "Passw0rd!"); err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry(repo, []string{"root", "alice"})
+	// регистрация под логином админа до его создания
+	if u, err := registry.SignUp(ctx, "root", "Passw0rd!"); !errors.Is(err, ErrUserExists) || slices.Contains(u.Roles, RoleAdmin) {
+		t.Fatalf("SignUp() of admin username = %+v, %v, want ErrUserExists", u, err)
+	}
+	for _, password := range []string{"Adm1n!pass", "other password"} {
+		// повторный запуск не меняет уже созданные аккаунты
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := registry.ProvisionAdmins(ctx, string(hash)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		username  string
+		password  string
+		wantAdmin bool
+	}{
+		{"root", "Adm1n!pass", true},
+		{"alice", "Passw0rd!", false},
+	}
+	for _, tt := range tests {
+		u, err := registry.Authenticate(ctx, tt.username, tt.password)
+		if err != nil {
+			t.Errorf("Authenticate(%q) error = %v", tt.username, err)
+			continue
+		}
+		if got := slices.Contains(u.Roles, RoleAdmin); got != tt.wantAdmin {
+			t.Errorf("Authenticate(%q) roles = %v, want admin %v", tt.username, u.Roles, tt.wantAdmin)
+		}
+	}
+	if u, err := registry.SignUp(ctx, "root", "Passw0rd!"); !errors.Is(err, ErrUserExists) || slices.Contains(u.Roles, RoleAdmin) {
+		t.Errorf("SignUp() of created admin = %+v, %v, want ErrUserExists", u, err)
+	}
+}
@@ -1,10 +1,19 @@
 package configs
 
 import (
+	"fmt"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/zkhrg/go_day03/internal/auth"
+	"github.com/zkhrg/go_day03/internal/logging"
 	"github.com/zkhrg/go_day03/internal/pkg/elasticsearch"
+	"github.com/zkhrg/go_day03/internal/places"
+	"github.com/zkhrg/go_day03/internal/quota"
+	"github.com/zkhrg/go_day03/internal/ratelimit"
+	"github.com/zkhrg/go_day03/internal/tracing"
 )
 
 type env string
@@ -23,19 +32,28 @@ type Configs struct {
 	Environment env
 	AppName     string
 	AppVersion  string
+	Settings    Settings
 }
 
 func (cfg *Configs) Elasticsearch() *elasticsearch.Config {
+	es := cfg.Settings.Elasticsearch
 	return &elasticsearch.Config{
-		Address:  os.Getenv("ES_ADDRESS"),
-		Username: os.Getenv("ES_USERNAME"),
-		Password: os.Getenv("ES_PASSWORD"),
-		Cert:     []byte(os.Getenv("ES_CERT_CONTENT")),
+		Address:                es.Address,
+		Username:               es.Username,
+		Password:               es.Password,
+		APIKey:                 es.APIKey,
+		ServiceToken:           es.ServiceToken,
+		Cert:                   []byte(es.Cert),
+		CAFile:                 es.CAFile,
+		CertificateFingerprint: es.Fingerprint,
+		ClientCertFile:         es.ClientCertFile,
+		ClientKeyFile:          es.ClientKeyFile,
+		InsecureSkipVerify:     es.InsecureSkipVerify,
 	}
 }
 
-func loadEnv() env {
-	switch env(os.Getenv("ENV")) {
+func loadEnv(name string) env {
+	switch env(name) {
 	case EnvLocal:
 		return EnvLocal
 	default:
@@ -44,16 +62,227 @@ func loadEnv() env {
 }
 
 // New возвращает новый инстанс конфига со всеми необходимыми
-// зависимостями инициализованно
-func New() (*Configs, error) {
+// зависимостями инициализованно. Настройки собираются из файла, окружения
+// (включая .env) и флагов командной строки args, см. Load
+func New(args []string) (*Configs, error) {
 	godotenv.Load()
+	s, err := Load(args)
+	if err != nil {
+		return nil, err
+	}
 	return &Configs{
-		Environment: loadEnv(),
-		AppName:     os.Getenv("APP_NAME"),
-		AppVersion:  os.Getenv("APP_VERSION"),
+		Environment: loadEnv(s.Env),
+		AppName:     s.AppName,
+		AppVersion:  s.AppVersion,
+		Settings:    s,
 	}, nil
 }
 
+// Logger логгер с уровнем LOG_LEVEL. Формат LOG_FORMAT, по умолчанию
+// text для локальной разработки и json для остальных окружений
+func (cfg *Configs) Logger() *slog.Logger {
+	format := cfg.Settings.Log.Format
+	if format == "" {
+		format = logging.FormatJSON
+		if cfg.Settings.Env == string(EnvLocal) {
+			format = logging.FormatText
+		}
+	}
+	// уровень и формат уже проверены в Validate
+	level, _ := logging.ParseLevel(cfg.Settings.Log.Level)
+	logger, _ := logging.New(os.Stderr, level, format)
+	return logger
+}
+
+// StoreTimeouts таймауты вызовов эластика
+func (cfg *Configs) StoreTimeouts() places.StoreTimeouts {
+	return places.StoreTimeouts{
+		Query: cfg.Settings.Elasticsearch.Timeout,
+		Bulk:  cfg.Settings.Elasticsearch.BulkTimeout,
+	}
+}
+
+// Tracing настройки экспорта спанов, сервис называется app_name
+func (cfg *Configs) Tracing() tracing.Config {
+	t := cfg.Settings.Tracing
+	return tracing.Config{
+		Exporter:       t.Exporter,
+		Endpoint:       t.Endpoint,
+		Insecure:       t.Insecure,
+		SampleRatio:    t.SampleRatio,
+		ServiceName:    cfg.AppName,
+		ServiceVersion: cfg.AppVersion,
+	}
+}
+
+// JWTKeys источник ключей подписи токенов: файл jwt.keys_file с набором
+// ключей, либо один ключ из jwt.secret. Если не задано ни то ни другое,
+// ключ генерируется при старте
+func (cfg *Configs) JWTKeys() auth.KeyLoader {
+	jwt := cfg.Settings.JWT
+	if jwt.KeysFile != "" {
+		return auth.FileKeyLoader(jwt.KeysFile)
+	}
+	if jwt.Secret != "" {
+		return auth.StaticKeyLoader(jwt.Kid, []byte(jwt.Secret))
+	}
+	slog.Warn("neither JWT_KEYS_FILE nor JWT_SECRET is set, using random key, tokens will not survive restart")
+	return auth.RandomKeyLoader()
+}
+
+// JWT настройки токенов, iss и aud по умолчанию APP_NAME
+func (cfg *Configs) JWT() auth.TokensConfig {
+	jwt := cfg.Settings.JWT
+	return auth.TokensConfig{
+		AllowedAlgs: jwt.AllowedAlgs,
+		AccessTTL:   jwt.AccessTTL,
+		Issuer:      orDefault(jwt.Issuer, cfg.AppName),
+		Audience:    orDefault(jwt.Audience, cfg.AppName),
+		Leeway:      jwt.Leeway,
+	}
+}
+
+// JWTRefreshTTL время жизни refresh токена, 0 - значение по умолчанию
+func (cfg *Configs) JWTRefreshTTL() time.Duration {
+	return cfg.Settings.JWT.RefreshTTL
+}
+
+// JWTKeysReloadInterval период перечитывания файла ключей, 0 - только по SIGHUP
+func (cfg *Configs) JWTKeysReloadInterval() time.Duration {
+	return cfg.Settings.JWT.KeysReloadInterval
+}
+
+// UsersFile путь к json файлу с зарегистрированными пользователями
+func (cfg *Configs) UsersFile() string {
+	return cfg.Settings.Auth.UsersFile
+}
+
+// APIKeysFile путь к json файлу с хэшами API ключей
+func (cfg *Configs) APIKeysFile() string {
+	return cfg.Settings.Auth.APIKeysFile
+}
+
+// OAuthClientsFile путь к json файлу с зарегистрированными OAuth клиентами
+func (cfg *Configs) OAuthClientsFile() string {
+	return cfg.Settings.Auth.OAuthClientsFile
+}
+
+// RateLimits лимиты запросов по маршрутам в формате "10/s:20", "off"
+// отключает лимит
+func (cfg *Configs) RateLimits() (ratelimit.Config, error) {
+	rl := cfg.Settings.RateLimit
+	res := ratelimit.Config{
+		Routes:            make(map[string]ratelimit.Limit),
+		TrustForwardedFor: rl.TrustForwardedFor,
+	}
+	routes := map[string]string{
+		"recommend": rl.Recommend,
+		"places":    rl.Places,
+	}
+	for route, spec := range routes {
+		if spec == "off" {
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(spec)
+		if err != nil {
+			return ratelimit.Config{}, fmt.Errorf("rate limit for %s: %w", route, err)
+		}
+		res.Routes[route] = limit
+	}
+	return res, nil
+}
+
+// RateLimitStore хранилище бакетов. Пока есть только memory
+func (cfg *Configs) RateLimitStore() (ratelimit.Store, error) {
+	switch backend := cfg.Settings.RateLimit.Backend; backend {
+	case "memory":
+		return ratelimit.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+}
+
+// QuotaPlans тарифные планы из quota.plans_file, без файла один план free
+func (cfg *Configs) QuotaPlans() (quota.Plans, error) {
+	path := cfg.Settings.Quota.PlansFile
+	if path == "" {
+		return quota.DefaultPlans(), nil
+	}
+	return quota.LoadPlans(path)
+}
+
+// QuotaUsageFile путь к json файлу со счетчиками использования квот
+func (cfg *Configs) QuotaUsageFile() string {
+	return cfg.Settings.Quota.UsageFile
+}
+
+// HTTP адрес и таймауты сервера
+func (cfg *Configs) HTTP() HTTPConfig {
+	return cfg.Settings.HTTP
+}
+
+// TLS настройки HTTPS сервера
+func (cfg *Configs) TLS() TLSSettings {
+	return cfg.Settings.TLS
+}
+
+// AdminUsers логины, которые получают роль admin
+func (cfg *Configs) AdminUsers() []string {
+	return cfg.Settings.Auth.AdminUsers
+}
+
+// AdminPasswordHash bcrypt хэш пароля, с которым создаются аккаунты админов
+func (cfg *Configs) AdminPasswordHash() string {
+	return cfg.Settings.Auth.AdminPasswordHash
+}
+
 func (cfg *Configs) PlacesElasticsearchIndex() string {
-	return "places"
+	return cfg.Settings.Places.Index
+}
+
+// PlacesDataset путь к датасету, который загружается при старте
+func (cfg *Configs) PlacesDataset() string {
+	return cfg.Settings.Places.Dataset
+}
+
+// PageSize сколько мест на одной странице
+func (cfg *Configs) PageSize() int {
+	return cfg.Settings.Places.PageSize
+}
+
+// Import настройки обработки датасета при загрузке
+func (cfg *Configs) Import() (places.ImportConfig, error) {
+	ic := places.DefaultImportConfig()
+	dedup, geo := cfg.Settings.Dedup, cfg.Settings.Geo
+	ic.Dedup = places.DedupConfig{
+		Enabled:            dedup.Enabled,
+		RadiusMeters:       dedup.RadiusMeters,
+		MinSimilarity:      dedup.MinSimilarity,
+		AutoMerge:          dedup.AutoMerge,
+		AutoMergeThreshold: dedup.AutoMergeThreshold,
+		ReviewFile:         dedup.ReviewFile,
+	}
+	if geo.RegionsFile != "" {
+		if err := ic.Geo.LoadRegions(geo.RegionsFile); err != nil {
+			return ic, err
+		}
+	}
+	if _, ok := ic.Geo.Regions[geo.Region]; !ok && geo.Region != "" {
+		return ic, fmt.Errorf("GEO_REGION: unknown region %q", geo.Region)
+	}
+	ic.Geo.DefaultRegion = geo.Region
+	ic.Geo.OutsideAction = geo.OutsideAction
+	return ic, nil
+}
+
+// Redacted настройки без секретов для /admin/config
+func (cfg *Configs) Redacted() map[string]any {
+	return cfg.Settings.Redacted()
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
 }
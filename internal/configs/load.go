@@ -0,0 +1,243 @@
+package configs
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[REDACTED]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field одна настройка: путь в файле, переменная окружения и ссылка на
+// значение внутри Settings
+type field struct {
+	path   string
+	env    string
+	secret bool
+	desc   string
+	value  reflect.Value
+}
+
+// flagName имя флага командной строки: places.page_size -> places-page-size
+func (f field) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(f.path)
+}
+
+// label как настройка называется в сообщениях об ошибках
+func (f field) label() string {
+	if f.env == "" {
+		return f.path
+	}
+	return fmt.Sprintf("%s (%s)", f.path, f.env)
+}
+
+// fields обходит Settings и возвращает все листовые настройки по порядку
+func (s *Settings) fields() []field {
+	var res []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			path := prefix + sf.Tag.Get("yaml")
+			if sf.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			res = append(res, field{
+				path:   path,
+				env:    sf.Tag.Get("env"),
+				secret: sf.Tag.Get("secret") == "true",
+				desc:   sf.Tag.Get("desc"),
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(s).Elem(), "")
+	return res
+}
+
+// set разбирает строковое значение из окружения или флага
+func (f field) set(raw string) error {
+	v := f.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Load собирает настройки по слоям: значения по умолчанию, файл из флага
+// -config или CONFIG_FILE, переменные окружения, флаги командной строки.
+// Каждый следующий слой перекрывает предыдущий. Результат проверяется
+// целиком, все найденные ошибки возвращаются вместе
+func Load(args []string) (Settings, error) {
+	s := defaultSettings()
+	fields := s.fields()
+
+	// флаги разбираются первыми, чтобы узнать путь к файлу, но применяются
+	// последними
+	type flagValue struct {
+		field field
+		raw   string
+	}
+	var flagValues []flagValue
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file (CONFIG_FILE)")
+	for _, f := range fields {
+		f := f
+		usage := f.desc
+		if f.env != "" {
+			usage += " (" + f.env + ")"
+		}
+		record := func(raw string) error {
+			flagValues = append(flagValues, flagValue{f, raw})
+			return nil
+		}
+		// булевы флаги можно передать без значения: -tls-self-signed
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(f.flagName(), usage, record)
+			continue
+		}
+		fs.Func(f.flagName(), usage, record)
+	}
+	if err := fs.Parse(args); err != nil {
+		return Settings{}, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, &s); err != nil {
+			return Settings{}, err
+		}
+	}
+
+	var errs []error
+	for _, f := range fields {
+		// пустые переменные не перекрывают файл, как и раньше
+		raw, ok := os.LookupEnv(f.env)
+		if f.env == "" || !ok || raw == "" {
+			continue
+		}
+		if err := f.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q: %w", f.env, raw, err))
+		}
+	}
+	for _, fv := range flagValues {
+		if err := fv.field.set(fv.raw); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: invalid value %q: %w", fv.field.flagName(), fv.raw, err))
+		}
+	}
+	if len(errs) > 0 {
+		return Settings{}, errors.Join(errs...)
+	}
+
+	if err := s.Validate(); err != nil {
+		return Settings{}, err
+	}
+	return s, nil
+}
+
+// loadFile читает YAML файл поверх значений по умолчанию. Неизвестные
+// ключи считаются ошибкой, чтобы опечатки не терялись молча
+func loadFile(path string, s *Settings) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q, use .yaml or .yml", path, ext)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Redacted настройки в виде вложенных map для /admin/config: секреты
+// заменены на [REDACTED], длительности записаны строками
+func (s Settings) Redacted() map[string]any {
+	res := make(map[string]any)
+	for _, f := range s.fields() {
+		node := res
+		parts := strings.Split(f.path, ".")
+		for _, p := range parts[:len(parts)-1] {
+			next, ok := node[p].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				node[p] = next
+			}
+			node = next
+		}
+		var v any
+		switch {
+		case f.secret:
+			v = ""
+			if !f.value.IsZero() {
+				v = redacted
+			}
+		case f.value.Type() == durationType:
+			v = time.Duration(f.value.Int()).String()
+		case f.value.Kind() == reflect.Slice && f.value.Len() == 0:
+			v = []string{}
+		default:
+			v = f.value.Interface()
+		}
+		node[parts[len(parts)-1]] = v
+	}
+	return res
+}
+
+// splitList значения через запятую без пробелов и пустых элементов
+func splitList(raw string) []string {
+	res := []string{}
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
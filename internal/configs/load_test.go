@@ -0,0 +1,35 @@
+package configs
+
+import "testing"
+
+func TestLoadFlags(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DEDUP_ENABLED", "true")
+	tests := []struct {
+		name    string
+		args    []string
+		check   func(s Settings) bool
+		wantErr bool
+	}{
+		{"bool without value", []string{"-tls-self-signed", "-tls-hsts-include-subdomains"}, func(s Settings) bool {
+			return s.TLS.SelfSigned && s.TLS.HSTSIncludeSubdomains
+		}, false},
+		{"bool with value", []string{"-dedup-enabled=false"}, func(s Settings) bool { return !s.Dedup.Enabled }, false},
+		{"bool overrides env", []string{"-dedup-enabled=0"}, func(s Settings) bool { return !s.Dedup.Enabled }, false},
+		{"not bool", []string{"-places-page-size", "20"}, func(s Settings) bool { return s.Places.PageSize == 20 }, false},
+		{"bool invalid", []string{"-elasticsearch-insecure-skip-verify=maybe"}, nil, true},
+		// значение через пробел у булевого флага не разбирается, как в пакете flag
+		{"bool value after space", []string{"-tls-self-signed", "false"}, func(s Settings) bool { return s.TLS.SelfSigned }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Load(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load(%q) error = %v, want error %v", tt.args, err, tt.wantErr)
+			}
+			if err == nil && !tt.check(s) {
+				t.Errorf("Load(%q) did not apply flags", tt.args)
+			}
+		})
+	}
+}
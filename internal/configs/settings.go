@@ -0,0 +1,227 @@
+package configs
+
+import (
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/places"
+	"github.com/zkhrg/go_day03/internal/tracing"
+)
+
+// Settings все настройки сервиса. Каждое поле задается в файле конфигурации
+// по ключу из тега yaml, переменной окружения из тега env и флагом командной
+// строки, имя которого получается из пути в файле: places.page_size ->
+// -places-page-size. Поля с тегом secret скрываются в /admin/config
+type Settings struct {
+	Env        string `yaml:"env" env:"ENV" desc:"environment name"`
+	AppName    string `yaml:"app_name" env:"APP_NAME" desc:"application name, default jwt issuer and audience"`
+	AppVersion string `yaml:"app_version" env:"APP_VERSION" desc:"application version"`
+
+	Log           LogSettings           `yaml:"log"`
+	Tracing       TracingSettings       `yaml:"tracing"`
+	HTTP          HTTPConfig            `yaml:"http"`
+	TLS           TLSSettings           `yaml:"tls"`
+	Elasticsearch ElasticsearchSettings `yaml:"elasticsearch"`
+	Places        PlacesSettings        `yaml:"places"`
+	JWT           JWTSettings           `yaml:"jwt"`
+	Auth          AuthSettings          `yaml:"auth"`
+	RateLimit     RateLimitSettings     `yaml:"rate_limit"`
+	Quota         QuotaSettings         `yaml:"quota"`
+	Dedup         DedupSettings         `yaml:"dedup"`
+	Geo           GeoSettings           `yaml:"geo"`
+}
+
+type LogSettings struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" desc:"debug, info, warn or error"`
+	// пусто - text для ENV=local, иначе json
+	Format string `yaml:"format" env:"LOG_FORMAT" desc:"text or json, json by default outside local environment"`
+}
+
+// TracingSettings куда отправлять спаны. W3C traceparent принимается и
+// передается эластику при любом экспортере
+type TracingSettings struct {
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" desc:"none, stdout or otlp"`
+	// OTLP/HTTP коллектор, например otel-collector или jaeger
+	Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" desc:"host:port of OTLP/HTTP collector"`
+	Insecure    bool    `yaml:"insecure" env:"OTEL_EXPORTER_OTLP_INSECURE" desc:"send spans to collector over plain HTTP"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" desc:"share of new traces to record, from 0 to 1"`
+}
+
+// HTTPConfig адрес и таймауты HTTP сервера
+type HTTPConfig struct {
+	Addr              string        `yaml:"addr" env:"HTTP_ADDR" desc:"listen address"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" desc:"timeout for reading request headers"`
+	// таймауты чтения и записи с запасом на загрузку датасета до 64MB
+	ReadTimeout  time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" desc:"timeout for reading whole request"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" desc:"timeout for writing response"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" desc:"keep-alive idle timeout"`
+	// дедлайн обработки запроса, в том числе всех вызовов эластика
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"HTTP_REQUEST_TIMEOUT" desc:"deadline for handling one request, 0 disables"`
+	// сколько ждать завершения текущих запросов после SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" desc:"how long to drain in-flight requests on shutdown"`
+}
+
+// TLSSettings HTTPS на http.addr. Включается файлами сертификата или
+// самоподписанным сертификатом для разработки
+type TLSSettings struct {
+	CertFile   string `yaml:"cert_file" env:"TLS_CERT_FILE" desc:"PEM certificate chain, enables HTTPS"`
+	KeyFile    string `yaml:"key_file" env:"TLS_KEY_FILE" desc:"PEM private key of tls.cert_file"`
+	SelfSigned bool   `yaml:"self_signed" env:"TLS_SELF_SIGNED" desc:"serve HTTPS with a generated self-signed certificate, for development"`
+	// как часто проверять, не сменились ли файлы сертификата
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL" desc:"period of checking certificate files for changes, 0 - only on SIGHUP"`
+	// адрес, на котором HTTP запросы перенаправляются на HTTPS, пусто - выключено
+	RedirectAddr string `yaml:"redirect_addr" env:"TLS_REDIRECT_ADDR" desc:"plain HTTP listen address redirecting to HTTPS"`
+	// 0 - заголовок Strict-Transport-Security не отправляется
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE" desc:"Strict-Transport-Security max-age, 0 disables HSTS"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS" desc:"add includeSubDomains to HSTS"`
+}
+
+// Enabled отвечает ли сервер по HTTPS
+func (t TLSSettings) Enabled() bool {
+	return t.CertFile != "" || t.SelfSigned
+}
+
+type ElasticsearchSettings struct {
+	Address  string `yaml:"address" env:"ES_ADDRESS" desc:"elasticsearch url"`
+	Username string `yaml:"username" env:"ES_USERNAME" desc:"elasticsearch user"`
+	Password string `yaml:"password" env:"ES_PASSWORD" secret:"true" desc:"elasticsearch password"`
+	// вместо логина и пароля можно использовать API ключ или сервисный токен
+	APIKey       string `yaml:"api_key" env:"ES_API_KEY" secret:"true" desc:"base64 encoded elasticsearch API key"`
+	ServiceToken string `yaml:"service_token" env:"ES_SERVICE_TOKEN" secret:"true" desc:"elasticsearch service account token"`
+	// PEM сертификат CA, которым подписан сертификат эластика
+	Cert        string `yaml:"cert" env:"ES_CERT_CONTENT" desc:"PEM CA certificate to verify elasticsearch"`
+	CAFile      string `yaml:"ca_file" env:"ES_CA_FILE" desc:"file with PEM CA certificates to verify elasticsearch"`
+	Fingerprint string `yaml:"fingerprint" env:"ES_CERT_FINGERPRINT" desc:"SHA256 hex fingerprint of elasticsearch certificate, instead of CA"`
+	// клиентский сертификат для mutual TLS
+	ClientCertFile     string `yaml:"client_cert_file" env:"ES_CLIENT_CERT_FILE" desc:"PEM client certificate for mutual TLS"`
+	ClientKeyFile      string `yaml:"client_key_file" env:"ES_CLIENT_KEY_FILE" desc:"PEM client key for mutual TLS"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env:"ES_INSECURE_SKIP_VERIFY" desc:"do not verify elasticsearch TLS certificate"`
+	// сколько ждать ответа на один вызов, но не дольше дедлайна запроса
+	Timeout     time.Duration `yaml:"timeout" env:"ES_TIMEOUT" desc:"timeout of one search or count call, 0 - request deadline only"`
+	BulkTimeout time.Duration `yaml:"bulk_timeout" env:"ES_BULK_TIMEOUT" desc:"timeout of indexing one import batch, 0 disables"`
+}
+
+type PlacesSettings struct {
+	Index    string `yaml:"index" env:"PLACES_INDEX" desc:"elasticsearch index with places"`
+	Dataset  string `yaml:"dataset" env:"DATASET_FILE" desc:"dataset indexed on startup"`
+	PageSize int    `yaml:"page_size" env:"PAGE_SIZE" desc:"places per page"`
+}
+
+type JWTSettings struct {
+	KeysFile string `yaml:"keys_file" env:"JWT_KEYS_FILE" desc:"json file with signing keys"`
+	Secret   string `yaml:"secret" env:"JWT_SECRET" secret:"true" desc:"single HS256 signing secret"`
+	Kid      string `yaml:"kid" env:"JWT_KID" desc:"key id of jwt.secret"`
+	// пусто - все поддерживаемые алгоритмы
+	AllowedAlgs []string `yaml:"allowed_algs" env:"JWT_ALLOWED_ALGS" desc:"accepted token algorithms, comma separated"`
+	// 0 - значения по умолчанию из пакета auth
+	AccessTTL  time.Duration `yaml:"access_ttl" env:"JWT_ACCESS_TTL" desc:"access token lifetime"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" env:"JWT_REFRESH_TTL" desc:"refresh token lifetime"`
+	Leeway     time.Duration `yaml:"leeway" env:"JWT_LEEWAY" desc:"allowed clock skew"`
+	// пусто - app_name
+	Issuer   string `yaml:"issuer" env:"JWT_ISSUER" desc:"token iss, app_name by default"`
+	Audience string `yaml:"audience" env:"JWT_AUDIENCE" desc:"token aud, app_name by default"`
+	// 0 - ключи перечитываются только по SIGHUP
+	KeysReloadInterval time.Duration `yaml:"keys_reload_interval" env:"JWT_KEYS_RELOAD_INTERVAL" desc:"period of reloading jwt.keys_file"`
+}
+
+type AuthSettings struct {
+	UsersFile  string   `yaml:"users_file" env:"USERS_FILE" desc:"json file with registered users"`
+	AdminUsers []string `yaml:"admin_users" env:"ADMIN_USERS" desc:"usernames with admin role, comma separated"`
+	// аккаунты из admin_users, которых еще нет, создаются при старте с этим паролем
+	AdminPasswordHash string `yaml:"admin_password_hash" env:"ADMIN_PASSWORD_HASH" secret:"true" desc:"bcrypt hash of the initial password of admin_users"`
+	APIKeysFile       string `yaml:"api_keys_file" env:"API_KEYS_FILE" desc:"json file with API key hashes"`
+	OAuthClientsFile  string `yaml:"oauth_clients_file" env:"OAUTH_CLIENTS_FILE" desc:"json file with OAuth clients"`
+}
+
+type RateLimitSettings struct {
+	// лимиты в формате "10/s:20", off отключает лимит
+	Recommend         string `yaml:"recommend" env:"RATE_LIMIT_RECOMMEND" desc:"rate limit of /api/recommend/, like 5/s:10 or off"`
+	Places            string `yaml:"places" env:"RATE_LIMIT_PLACES" desc:"rate limit of /api/places/, like 10/s:20 or off"`
+	TrustForwardedFor bool   `yaml:"trust_forwarded_for" env:"RATE_LIMIT_TRUST_FORWARDED_FOR" desc:"identify clients by X-Forwarded-For"`
+	Backend           string `yaml:"backend" env:"RATE_LIMIT_BACKEND" desc:"rate limit state backend"`
+}
+
+type QuotaSettings struct {
+	PlansFile string `yaml:"plans_file" env:"QUOTA_PLANS_FILE" desc:"json file with quota plans"`
+	UsageFile string `yaml:"usage_file" env:"QUOTA_USAGE_FILE" desc:"json file with usage counters"`
+}
+
+type DedupSettings struct {
+	Enabled            bool    `yaml:"enabled" env:"DEDUP_ENABLED" desc:"look for duplicates on import"`
+	RadiusMeters       float64 `yaml:"radius_meters" env:"DEDUP_RADIUS_METERS" desc:"max distance between duplicates"`
+	MinSimilarity      float64 `yaml:"min_similarity" env:"DEDUP_MIN_SIMILARITY" desc:"min name similarity of duplicate candidates"`
+	AutoMerge          bool    `yaml:"auto_merge" env:"DEDUP_AUTO_MERGE" desc:"hide duplicates above auto_merge_threshold"`
+	AutoMergeThreshold float64 `yaml:"auto_merge_threshold" env:"DEDUP_AUTO_MERGE_THRESHOLD" desc:"name similarity to merge automatically"`
+	ReviewFile         string  `yaml:"review_file" env:"DEDUP_REVIEW_FILE" desc:"json lines file with candidate pairs"`
+}
+
+type GeoSettings struct {
+	RegionsFile   string `yaml:"regions_file" env:"GEO_REGIONS_FILE" desc:"json file with extra regions"`
+	Region        string `yaml:"region" env:"GEO_REGION" desc:"region to check coordinates against"`
+	OutsideAction string `yaml:"outside_action" env:"GEO_OUTSIDE_ACTION" desc:"reject or quarantine points outside region"`
+}
+
+// defaultSettings значения, которые действуют без файла, окружения и флагов
+func defaultSettings() Settings {
+	importCfg := places.DefaultImportConfig()
+	return Settings{
+		Env: string(EnvLocal),
+		Log: LogSettings{
+			Level: "info",
+		},
+		Tracing: TracingSettings{
+			Exporter:    tracing.ExporterNone,
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			SampleRatio: 1,
+		},
+		HTTP: HTTPConfig{
+			Addr:              ":8888",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       60 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			RequestTimeout:    10 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		TLS: TLSSettings{
+			ReloadInterval: time.Minute,
+		},
+		Elasticsearch: ElasticsearchSettings{
+			Address:     "http://localhost:9200",
+			Timeout:     5 * time.Second,
+			BulkTimeout: time.Minute,
+		},
+		Places: PlacesSettings{
+			Index:    "places",
+			Dataset:  "./datasets/data.csv",
+			PageSize: 10,
+		},
+		JWT: JWTSettings{
+			Kid: "default",
+		},
+		Auth: AuthSettings{
+			UsersFile:        "./users.json",
+			APIKeysFile:      "./api_keys.json",
+			OAuthClientsFile: "./oauth_clients.json",
+		},
+		RateLimit: RateLimitSettings{
+			Recommend: "5/s:10",
+			Places:    "10/s:20",
+			Backend:   "memory",
+		},
+		Quota: QuotaSettings{
+			UsageFile: "./usage.json",
+		},
+		Dedup: DedupSettings{
+			Enabled:            importCfg.Dedup.Enabled,
+			RadiusMeters:       importCfg.Dedup.RadiusMeters,
+			MinSimilarity:      importCfg.Dedup.MinSimilarity,
+			AutoMerge:          importCfg.Dedup.AutoMerge,
+			AutoMergeThreshold: importCfg.Dedup.AutoMergeThreshold,
+		},
+		Geo: GeoSettings{
+			Region:        importCfg.Geo.DefaultRegion,
+			OutsideAction: importCfg.Geo.OutsideAction,
+		},
+	}
+}
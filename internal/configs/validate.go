@@ -0,0 +1,205 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/zkhrg/go_day03/internal/auth"
+	"github.com/zkhrg/go_day03/internal/logging"
+	"github.com/zkhrg/go_day03/internal/places"
+	"github.com/zkhrg/go_day03/internal/ratelimit"
+	"github.com/zkhrg/go_day03/internal/tracing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const maxPageSize = 100
+
+// правила имени индекса эластика: строчные буквы, без \ / * ? " < > | , # :
+// и пробелов, не начинается с - _ +
+var indexNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+var fingerprintRe = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// Validate проверяет настройки целиком и возвращает все ошибки сразу, каждая
+// с путем в файле и переменной окружения
+func (s *Settings) Validate() error {
+	labels := make(map[string]string)
+	for _, f := range s.fields() {
+		labels[f.path] = f.label()
+	}
+	var errs []error
+	bad := func(path, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", labels[path], fmt.Sprintf(format, args...)))
+	}
+
+	if _, err := logging.ParseLevel(s.Log.Level); err != nil {
+		bad("log.level", "must be debug, info, warn or error, got %q", s.Log.Level)
+	}
+	switch s.Log.Format {
+	case "", logging.FormatText, logging.FormatJSON:
+	default:
+		bad("log.format", "must be %s or %s, got %q", logging.FormatText, logging.FormatJSON, s.Log.Format)
+	}
+
+	switch s.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterOTLP:
+		if s.Tracing.Endpoint == "" {
+			bad("tracing.endpoint", "must be set for %s exporter", tracing.ExporterOTLP)
+		}
+	default:
+		bad("tracing.exporter", "must be %s, %s or %s, got %q",
+			tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP, s.Tracing.Exporter)
+	}
+	if s.Tracing.SampleRatio < 0 || s.Tracing.SampleRatio > 1 {
+		bad("tracing.sample_ratio", "must be between 0 and 1, got %v", s.Tracing.SampleRatio)
+	}
+
+	if s.HTTP.Addr == "" {
+		bad("http.addr", "must not be empty")
+	}
+	for path, d := range map[string]int64{
+		"http.read_header_timeout":   int64(s.HTTP.ReadHeaderTimeout),
+		"http.read_timeout":          int64(s.HTTP.ReadTimeout),
+		"http.write_timeout":         int64(s.HTTP.WriteTimeout),
+		"http.idle_timeout":          int64(s.HTTP.IdleTimeout),
+		"http.shutdown_timeout":      int64(s.HTTP.ShutdownTimeout),
+		"http.request_timeout":       int64(s.HTTP.RequestTimeout),
+		"elasticsearch.timeout":      int64(s.Elasticsearch.Timeout),
+		"elasticsearch.bulk_timeout": int64(s.Elasticsearch.BulkTimeout),
+	} {
+		if d < 0 {
+			bad(path, "must not be negative")
+		}
+	}
+
+	tlsCfg := s.TLS
+	if (tlsCfg.CertFile == "") != (tlsCfg.KeyFile == "") {
+		bad("tls.cert_file", "must be set together with tls.key_file")
+	}
+	if tlsCfg.SelfSigned && tlsCfg.CertFile != "" {
+		bad("tls.self_signed", "must not be set together with tls.cert_file")
+	}
+	if tlsCfg.ReloadInterval < 0 {
+		bad("tls.reload_interval", "must not be negative")
+	}
+	if !tlsCfg.Enabled() && tlsCfg.RedirectAddr != "" {
+		bad("tls.redirect_addr", "requires tls.cert_file or tls.self_signed")
+	}
+	if tlsCfg.RedirectAddr != "" && tlsCfg.RedirectAddr == s.HTTP.Addr {
+		bad("tls.redirect_addr", "must differ from http.addr")
+	}
+	if tlsCfg.HSTSMaxAge < 0 {
+		bad("tls.hsts_max_age", "must not be negative")
+	}
+	if !tlsCfg.Enabled() && tlsCfg.HSTSMaxAge > 0 {
+		bad("tls.hsts_max_age", "requires tls.cert_file or tls.self_signed")
+	}
+
+	if u, err := url.Parse(s.Elasticsearch.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		bad("elasticsearch.address", "must be an http or https url, got %q", s.Elasticsearch.Address)
+	}
+	es := s.Elasticsearch
+	credentials := 0
+	for _, set := range []bool{es.Username != "" || es.Password != "", es.APIKey != "", es.ServiceToken != ""} {
+		if set {
+			credentials++
+		}
+	}
+	if credentials > 1 {
+		bad("elasticsearch.api_key", "use only one of username and password, api_key or service_token")
+	}
+	if es.InsecureSkipVerify && (es.Cert != "" || es.CAFile != "" || es.Fingerprint != "") {
+		bad("elasticsearch.insecure_skip_verify", "must not be set together with cert, ca_file or fingerprint")
+	}
+	if es.Fingerprint != "" && (es.Cert != "" || es.CAFile != "") {
+		bad("elasticsearch.fingerprint", "must not be set together with cert or ca_file")
+	}
+	if fp := strings.ReplaceAll(es.Fingerprint, ":", ""); es.Fingerprint != "" && !fingerprintRe.MatchString(fp) {
+		bad("elasticsearch.fingerprint", "must be a SHA256 hex digest")
+	}
+	if (es.ClientCertFile == "") != (es.ClientKeyFile == "") {
+		bad("elasticsearch.client_cert_file", "must be set together with elasticsearch.client_key_file")
+	}
+
+	if len(s.Places.Index) > 255 || !indexNameRe.MatchString(s.Places.Index) {
+		bad("places.index", "must be a valid elasticsearch index name, got %q", s.Places.Index)
+	}
+	if s.Places.Dataset == "" {
+		bad("places.dataset", "must not be empty")
+	}
+	if s.Places.PageSize < 1 || s.Places.PageSize > maxPageSize {
+		bad("places.page_size", "must be between 1 and %d, got %d", maxPageSize, s.Places.PageSize)
+	}
+
+	if s.JWT.KeysFile != "" && s.JWT.Secret != "" {
+		bad("jwt.secret", "must not be set together with jwt.keys_file")
+	}
+	for _, alg := range s.JWT.AllowedAlgs {
+		if !slices.Contains(auth.SupportedAlgs, alg) {
+			bad("jwt.allowed_algs", "unsupported algorithm %q, supported: %s", alg, strings.Join(auth.SupportedAlgs, ", "))
+		}
+	}
+	if len(s.Auth.AdminUsers) > 0 && s.Auth.AdminPasswordHash == "" {
+		bad("auth.admin_password_hash", "must be set when auth.admin_users is not empty")
+	}
+	if s.Auth.AdminPasswordHash != "" {
+		if _, err := bcrypt.Cost([]byte(s.Auth.AdminPasswordHash)); err != nil {
+			bad("auth.admin_password_hash", "must be a bcrypt hash: %s", err)
+		}
+	}
+	for path, d := range map[string]int64{
+		"jwt.access_ttl":           int64(s.JWT.AccessTTL),
+		"jwt.refresh_ttl":          int64(s.JWT.RefreshTTL),
+		"jwt.leeway":               int64(s.JWT.Leeway),
+		"jwt.keys_reload_interval": int64(s.JWT.KeysReloadInterval),
+	} {
+		if d < 0 {
+			bad(path, "must not be negative")
+		}
+	}
+
+	for path, spec := range map[string]string{
+		"rate_limit.recommend": s.RateLimit.Recommend,
+		"rate_limit.places":    s.RateLimit.Places,
+	} {
+		if spec == "off" {
+			continue
+		}
+		if _, err := ratelimit.ParseLimit(spec); err != nil {
+			bad(path, "%s", err)
+		}
+	}
+	if s.RateLimit.Backend != "memory" {
+		bad("rate_limit.backend", "unknown backend %q, supported: memory", s.RateLimit.Backend)
+	}
+
+	if s.Dedup.RadiusMeters <= 0 {
+		bad("dedup.radius_meters", "must be positive")
+	}
+	if s.Dedup.MinSimilarity < 0 || s.Dedup.MinSimilarity > 1 {
+		bad("dedup.min_similarity", "must be between 0 and 1")
+	}
+	if s.Dedup.AutoMergeThreshold < 0 || s.Dedup.AutoMergeThreshold > 1 {
+		bad("dedup.auto_merge_threshold", "must be between 0 and 1")
+	}
+	if s.Dedup.Enabled && s.Dedup.AutoMerge && s.Dedup.ReviewFile == "" {
+		bad("dedup.review_file", "must be set when auto_merge is on, merged places are hidden")
+	}
+	switch s.Geo.OutsideAction {
+	case places.OutsideActionReject, places.OutsideActionQuarantine:
+	default:
+		bad("geo.outside_action", "must be %q or %q, got %q",
+			places.OutsideActionReject, places.OutsideActionQuarantine, s.Geo.OutsideAction)
+	}
+
+	// порядок map не постоянный, ошибки сортируются для стабильного вывода
+	slices.SortFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+	return errors.Join(errs...)
+}
@@ -0,0 +1,124 @@
+package configs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *Settings)
+		// начало каждой ожидаемой ошибки, пусто - настройки корректны
+		want []string
+	}{
+		{"defaults", func(s *Settings) {}, nil},
+		{
+			"self signed tls with redirect and hsts",
+			func(s *Settings) {
+				s.TLS.SelfSigned = true
+				s.TLS.RedirectAddr = ":8080"
+				s.TLS.HSTSMaxAge = time.Hour
+			},
+			nil,
+		},
+		{"log level", func(s *Settings) { s.Log.Level = "trace" }, []string{"log.level (LOG_LEVEL): must be debug"}},
+		{"log format", func(s *Settings) { s.Log.Format = "xml" }, []string{"log.format (LOG_FORMAT): must be text or json"}},
+		{"otlp without endpoint", func(s *Settings) {
+			s.Tracing.Exporter = "otlp"
+			s.Tracing.Endpoint = ""
+		}, []string{"tracing.endpoint (OTEL_EXPORTER_OTLP_ENDPOINT): must be set"}},
+		{"sample ratio", func(s *Settings) { s.Tracing.SampleRatio = 1.5 }, []string{"tracing.sample_ratio (TRACING_SAMPLE_RATIO)"}},
+		{"empty addr", func(s *Settings) { s.HTTP.Addr = "" }, []string{"http.addr (HTTP_ADDR): must not be empty"}},
+		{"negative timeout", func(s *Settings) { s.HTTP.ReadTimeout = -time.Second }, []string{"http.read_timeout (HTTP_READ_TIMEOUT): must not be negative"}},
+		{"negative request timeout", func(s *Settings) { s.HTTP.RequestTimeout = -time.Second }, []string{"http.request_timeout (HTTP_REQUEST_TIMEOUT): must not be negative"}},
+		{"cert without key", func(s *Settings) { s.TLS.CertFile = "cert.pem" }, []string{"tls.cert_file (TLS_CERT_FILE): must be set together"}},
+		{"self signed with cert", func(s *Settings) {
+			s.TLS.SelfSigned = true
+			s.TLS.CertFile = "cert.pem"
+			s.TLS.KeyFile = "key.pem"
+		}, []string{"tls.self_signed (TLS_SELF_SIGNED)"}},
+		{"redirect without tls", func(s *Settings) { s.TLS.RedirectAddr = ":8080" }, []string{"tls.redirect_addr (TLS_REDIRECT_ADDR): requires"}},
+		{"redirect on same addr", func(s *Settings) {
+			s.TLS.SelfSigned = true
+			s.TLS.RedirectAddr = s.HTTP.Addr
+		}, []string{"tls.redirect_addr (TLS_REDIRECT_ADDR): must differ"}},
+		{"hsts without tls", func(s *Settings) { s.TLS.HSTSMaxAge = time.Hour }, []string{"tls.hsts_max_age (HSTS_MAX_AGE): requires"}},
+		{"es address", func(s *Settings) { s.Elasticsearch.Address = "localhost:9200" }, []string{"elasticsearch.address (ES_ADDRESS)"}},
+		{"insecure with cert", func(s *Settings) {
+			s.Elasticsearch.InsecureSkipVerify = true
+			s.Elasticsearch.Cert = "-----BEGIN CERTIFICATE-----"
+		}, []string{"elasticsearch.insecure_skip_verify (ES_INSECURE_SKIP_VERIFY)"}},
+		{"es credentials", func(s *Settings) {
+			s.Elasticsearch.Username = "elastic"
+			s.Elasticsearch.APIKey = "key"
+		}, []string{"elasticsearch.api_key (ES_API_KEY): use only one"}},
+		{"insecure with ca", func(s *Settings) {
+			s.Elasticsearch.InsecureSkipVerify = true
+			s.Elasticsearch.CAFile = "ca.pem"
+		}, []string{"elasticsearch.insecure_skip_verify (ES_INSECURE_SKIP_VERIFY)"}},
+		{"fingerprint with ca", func(s *Settings) {
+			s.Elasticsearch.Fingerprint = strings.Repeat("ab", 32)
+			s.Elasticsearch.CAFile = "ca.pem"
+		}, []string{"elasticsearch.fingerprint (ES_CERT_FINGERPRINT): must not be set together"}},
+		{"short fingerprint", func(s *Settings) { s.Elasticsearch.Fingerprint = "ab:cd" }, []string{"elasticsearch.fingerprint (ES_CERT_FINGERPRINT): must be a SHA256"}},
+		{"client cert without key", func(s *Settings) { s.Elasticsearch.ClientCertFile = "client.pem" }, []string{"elasticsearch.client_cert_file (ES_CLIENT_CERT_FILE)"}},
+		{"index name", func(s *Settings) { s.Places.Index = "Places" }, []string{"places.index (PLACES_INDEX)"}},
+		{"page size", func(s *Settings) { s.Places.PageSize = maxPageSize + 1 }, []string{"places.page_size (PAGE_SIZE): must be between 1 and 100"}},
+		{"jwt secret with keys file", func(s *Settings) {
+			s.JWT.Secret = "secret"
+			s.JWT.KeysFile = "keys.json"
+		}, []string{"jwt.secret (JWT_SECRET): must not be set together"}},
+		{"jwt alg", func(s *Settings) { s.JWT.AllowedAlgs = []string{"HS256", "none"} }, []string{`jwt.allowed_algs (JWT_ALLOWED_ALGS): unsupported algorithm "none"`}},
+		{"admins without password", func(s *Settings) { s.Auth.AdminUsers = []string{"root"} }, []string{"auth.admin_password_hash (ADMIN_PASSWORD_HASH): must be set"}},
+		{"admin password not hashed", func(s *Settings) {
+			s.Auth.AdminUsers = []string{"root"}
+			s.Auth.AdminPasswordHash = "Adm1n!pass"
+		}, []string{"auth.admin_password_hash (ADMIN_PASSWORD_HASH): must be a bcrypt hash"}},
+		{"rate limit", func(s *Settings) { s.RateLimit.Places = "10 per second" }, []string{"rate_limit.places (RATE_LIMIT_PLACES)"}},
+		{"rate limit off", func(s *Settings) { s.RateLimit.Recommend = "off" }, nil},
+		{"rate limit backend", func(s *Settings) { s.RateLimit.Backend = "redis" }, []string{"rate_limit.backend (RATE_LIMIT_BACKEND)"}},
+		{"dedup radius", func(s *Settings) { s.Dedup.RadiusMeters = 0 }, []string{"dedup.radius_meters (DEDUP_RADIUS_METERS)"}},
+		{"auto merge without review file", func(s *Settings) { s.Dedup.AutoMerge = true }, []string{"dedup.review_file (DEDUP_REVIEW_FILE)"}},
+		{"auto merge with review file", func(s *Settings) {
+			s.Dedup.AutoMerge = true
+			s.Dedup.ReviewFile = "review.jsonl"
+		}, nil},
+		{"outside action", func(s *Settings) { s.Geo.OutsideAction = "drop" }, []string{"geo.outside_action (GEO_OUTSIDE_ACTION)"}},
+		{
+			"all errors at once",
+			func(s *Settings) {
+				s.Places.PageSize = 0
+				s.RateLimit.Backend = "redis"
+				s.HTTP.Addr = ""
+			},
+			[]string{"http.addr", "places.page_size", "rate_limit.backend"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultSettings()
+			tt.change(&s)
+			err := s.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.want)
+			}
+			got := strings.Split(err.Error(), "\n")
+			if len(got) != len(tt.want) {
+				t.Fatalf("Validate() errors = %q, want %q", got, tt.want)
+			}
+			for i, prefix := range tt.want {
+				if !strings.HasPrefix(got[i], prefix) {
+					t.Errorf("error %d = %q, want prefix %q", i, got[i], prefix)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New логгер с уровнем level в формате text или json. Записи, сделанные с
+// контекстом запроса, получают request_id, user и trace_id
+func New(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch format {
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use %s or %s", format, FormatText, FormatJSON)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// ParseLevel debug, info, warn или error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// request то, что известно о запросе. Пользователь становится известен
+// только после проверки токена глубже по цепочке, поэтому он записывается
+// в уже положенную в контекст структуру
+type request struct {
+	id   string
+	user atomic.Pointer[string]
+}
+
+type ctxKey struct{}
+
+// WithRequestID кладет в контекст идентификатор запроса
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &request{id: id})
+}
+
+// RequestID идентификатор запроса из контекста или пустая строка
+func RequestID(ctx context.Context) string {
+	if req, ok := ctx.Value(ctxKey{}).(*request); ok {
+		return req.id
+	}
+	return ""
+}
+
+// SetUser запоминает, от чьего имени выполняется запрос
+func SetUser(ctx context.Context, user string) {
+	if req, ok := ctx.Value(ctxKey{}).(*request); ok {
+		req.user.Store(&user)
+	}
+}
+
+// User пользователь запроса, если он уже известен
+func User(ctx context.Context) string {
+	if req, ok := ctx.Value(ctxKey{}).(*request); ok {
+		if user := req.user.Load(); user != nil {
+			return *user
+		}
+	}
+	return ""
+}
+
+// contextHandler добавляет к записи поля запроса из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+		if user := User(ctx); user != "" {
+			r.AddAttrs(slog.String("user", user))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
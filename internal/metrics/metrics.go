@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// метрики регистрируются в реестре по умолчанию вместе с метриками рантайма
+// Go и процесса
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	storeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "store_request_duration_seconds",
+		Help:    "Latency of Elasticsearch calls by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	storeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "store_errors_total",
+		Help: "Failed Elasticsearch calls by operation.",
+	}, []string{"operation"})
+
+	importRows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "import_rows_total",
+		Help: "Dataset rows processed on import by result.",
+	}, []string{"result"})
+
+	buildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "Application name and version, always 1.",
+	}, []string{"app", "version", "goversion"})
+)
+
+// операции эластика
+const (
+	OpSearch = "search"
+	OpCount  = "count"
+	OpBulk   = "bulk"
+)
+
+// результаты обработки строк датасета
+const (
+	RowsRead        = "read"
+	RowsIndexed     = "indexed"
+	RowsRejected    = "rejected"
+	RowsQuarantined = "quarantined"
+	RowsSwapped     = "swapped"
+	RowsSuppressed  = "suppressed"
+)
+
+// ObserveHTTP учитывает обработанный запрос
+func ObserveHTTP(route, method string, code int, d time.Duration) {
+	labels := prometheus.Labels{"route": route, "method": normalizeMethod(method), "code": strconv.Itoa(code)}
+	httpRequests.With(labels).Inc()
+	httpDuration.With(labels).Observe(d.Seconds())
+}
+
+// ObserveStore учитывает вызов эластика, начатый в start
+func ObserveStore(operation string, start time.Time, failed bool) {
+	storeDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if failed {
+		storeErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// AddImportRows учитывает n строк датасета с результатом result
+func AddImportRows(result string, n int) {
+	importRows.WithLabelValues(result).Add(float64(n))
+}
+
+func SetBuildInfo(app, version string) {
+	buildInfo.WithLabelValues(app, version, runtime.Version()).Set(1)
+}
+
+// Handler отдает метрики в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// normalizeMethod нестандартные методы сводятся в один label, чтобы клиент
+// не мог раздуть число временных рядов
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "OTHER"
+	}
+}
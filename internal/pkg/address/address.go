@@ -0,0 +1,120 @@
+package address
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrEmpty   = errors.New("address is empty")
+	ErrNoHouse = errors.New("address has no house number")
+	ErrNoPlace = errors.New("address has neither street nor locality")
+)
+
+// Components адрес, разобранный на части. Адреса в датасете транслитерированы,
+// поэтому и типы улиц здесь в транслите: "ulitsa", "prospekt" и т.д.
+type Components struct {
+	City       string   `json:"city,omitempty"`
+	StreetType string   `json:"street_type,omitempty"`
+	StreetName string   `json:"street_name,omitempty"`
+	House      string   `json:"house,omitempty"`
+	Building   string   `json:"building,omitempty"`
+	Structure  string   `json:"structure,omitempty"`
+	Extra      []string `json:"extra,omitempty"`
+	Malformed  bool     `json:"malformed"`
+}
+
+var streetTypes = map[string]bool{
+	"ulitsa":       true,
+	"prospekt":     true,
+	"shosse":       true,
+	"pereulok":     true,
+	"bul'var":      true,
+	"proezd":       true,
+	"naberezhnaja": true,
+	"ploschad'":    true,
+	"alleja":       true,
+	"tupik":        true,
+	"linija":       true,
+	"prosek":       true,
+}
+
+var housePrefixes = []string{"domovladenie ", "vladenie ", "dom "}
+
+// Parse разбирает адрес вида "gorod Moskva, ulitsa Egora Abakumova, dom 9, korpus 1".
+// При ошибке возвращаются те компоненты, которые удалось выделить, с Malformed = true
+func Parse(raw string) (Components, error) {
+	var c Components
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		c.Malformed = true
+		return c, ErrEmpty
+	}
+
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if city, ok := strings.CutPrefix(part, "gorod "); ok && c.City == "" {
+			c.City = city
+			continue
+		}
+		if house, ok := cutHousePrefix(part); ok && c.House == "" {
+			c.House = house
+			continue
+		}
+		if building, ok := strings.CutPrefix(part, "korpus "); ok && c.Building == "" {
+			c.Building = building
+			continue
+		}
+		if structure, ok := strings.CutPrefix(part, "stroenie "); ok && c.Structure == "" {
+			c.Structure = structure
+			continue
+		}
+		if c.StreetType == "" {
+			if streetType, streetName, ok := splitStreet(part); ok {
+				c.StreetType, c.StreetName = streetType, streetName
+				continue
+			}
+		}
+		c.Extra = append(c.Extra, part)
+	}
+
+	switch {
+	// в Зеленограде дома нумеруются корпусами без номера дома
+	case c.House == "" && c.Building == "":
+		c.Malformed = true
+		return c, ErrNoHouse
+	case c.StreetType == "" && len(c.Extra) == 0:
+		c.Malformed = true
+		return c, ErrNoPlace
+	}
+	return c, nil
+}
+
+func cutHousePrefix(part string) (string, bool) {
+	for _, prefix := range housePrefixes {
+		if house, ok := strings.CutPrefix(part, prefix); ok {
+			return house, true
+		}
+	}
+	return "", false
+}
+
+// splitStreet ищет тип улицы среди слов, он может стоять как в начале
+// ("ulitsa Talalihina"), так и в конце ("Abramtsevskaja ulitsa")
+func splitStreet(part string) (string, string, bool) {
+	words := strings.Fields(part)
+	for i, w := range words {
+		if streetTypes[w] {
+			name := append(append([]string{}, words[:i]...), words[i+1:]...)
+			if len(name) == 0 {
+				return "", "", false
+			}
+			return w, strings.Join(name, " "), true
+		}
+	}
+	return "", "", false
+}
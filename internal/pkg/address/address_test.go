@@ -0,0 +1,83 @@
+package address
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Components
+		wantErr error
+	}{
+		// строки из datasets/data.csv
+		{
+			"gorod Moskva, ulitsa Egora Abakumova, dom 9",
+			Components{City: "Moskva", StreetType: "ulitsa", StreetName: "Egora Abakumova", House: "9"},
+			nil,
+		},
+		{
+			"gorod Moskva, ulitsa Talalihina, dom 2/1, korpus 1",
+			Components{City: "Moskva", StreetType: "ulitsa", StreetName: "Talalihina", House: "2/1", Building: "1"},
+			nil,
+		},
+		{
+			"gorod Moskva, Abel'manovskaja ulitsa, dom 6",
+			Components{City: "Moskva", StreetType: "ulitsa", StreetName: "Abel'manovskaja", House: "6"},
+			nil,
+		},
+		{
+			"gorod Moskva, Aviamotornaja ulitsa, dom 8, stroenie 1",
+			Components{City: "Moskva", StreetType: "ulitsa", StreetName: "Aviamotornaja", House: "8", Structure: "1"},
+			nil,
+		},
+		{
+			"gorod Moskva, Nagornaja ulitsa, vladenie 25, stroenie 1",
+			Components{City: "Moskva", StreetType: "ulitsa", StreetName: "Nagornaja", House: "25", Structure: "1"},
+			nil,
+		},
+		{
+			"gorod Moskva, Nahimovskij prospekt, vladenie 75A",
+			Components{City: "Moskva", StreetType: "prospekt", StreetName: "Nahimovskij", House: "75A"},
+			nil,
+		},
+		{
+			"gorod Moskva, gorod Zelenograd, korpus 435",
+			Components{City: "Moskva", Building: "435", Extra: []string{"gorod Zelenograd"}},
+			nil,
+		},
+		{
+			"gorod Moskva, poselenie Vnukovskoe, ulitsa Letchika Ul'janina, dom 2",
+			Components{City: "Moskva", StreetType: "ulitsa", StreetName: "Letchika Ul'janina", House: "2", Extra: []string{"poselenie Vnukovskoe"}},
+			nil,
+		},
+		{
+			"poselenie Voronovskoe, selo Voronovo, stroenie 1",
+			Components{Structure: "1", Extra: []string{"poselenie Voronovskoe", "selo Voronovo"}, Malformed: true},
+			ErrNoHouse,
+		},
+		{
+			"gorod Moskva, gorod Zelenograd, Krjukovskaja ploschad', stroenie 8",
+			Components{City: "Moskva", StreetType: "ploschad'", StreetName: "Krjukovskaja", Structure: "8", Extra: []string{"gorod Zelenograd"}, Malformed: true},
+			ErrNoHouse,
+		},
+		{
+			"gorod Moskva, dom 5",
+			Components{City: "Moskva", House: "5", Malformed: true},
+			ErrNoPlace,
+		},
+		{"  ", Components{Malformed: true}, ErrEmpty},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.raw)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
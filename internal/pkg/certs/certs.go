@@ -0,0 +1,171 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNoCertificate = errors.New("no certificate loaded")
+
+// Reloader отдает серверу текущий сертификат и перечитывает файлы, когда
+// они меняются, например при ротации cert-manager. Соединения, открытые со
+// старым сертификатом, продолжают работать
+type Reloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Static сертификат без файлов, например самоподписанный
+func Static(cert tls.Certificate) *Reloader {
+	return &Reloader{cert: &cert}
+}
+
+// Reload загружает пару сертификат и ключ заново. Если новая пара
+// некорректна, продолжает работать старая
+func (r *Reloader) Reload() error {
+	if r.certFile == "" {
+		return nil
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// changed изменился ли какой-нибудь из файлов с последней загрузки
+func (r *Reloader) changed() bool {
+	if r.certFile == "" {
+		return false
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		// файл может временно пропасть во время замены, проверим в следующий раз
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !modTime.Equal(r.modTime)
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ReloadOn перечитывает файлы по сигналу из signals и раз в interval, если
+// они изменились. Блокируется до отмены ctx
+func (r *Reloader) ReloadOn(ctx context.Context, signals <-chan os.Signal, interval time.Duration) {
+	// самоподписанный сертификат перечитывать неоткуда
+	if r.certFile == "" {
+		return
+	}
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		case <-tick:
+			if !r.changed() {
+				continue
+			}
+		}
+		if err := r.Reload(); err != nil {
+			slog.Error("cannot reload tls certificate, keeping previous one", "err", err)
+			continue
+		}
+		slog.Info("tls certificate reloaded")
+	}
+}
+
+// GetCertificate для tls.Config, сертификат берется на каждое рукопожатие
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert == nil {
+		return nil, ErrNoCertificate
+	}
+	return r.cert, nil
+}
+
+// SelfSigned выпускает самоподписанный сертификат для localhost на год,
+// только для локальной разработки
+func SelfSigned(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "localhost", Organization: []string{"go_day03 development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range append([]string{"localhost", "127.0.0.1", "::1"}, hosts...) {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
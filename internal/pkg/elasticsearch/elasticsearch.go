@@ -1,11 +1,22 @@
 package elasticsearch
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/elastic/go-elasticsearch/v8"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 const batchSize = 500
@@ -14,25 +25,179 @@ type Config struct {
 	Address  string
 	Username string
 	Password string
-	Cert     []byte
+	// API ключ эластика в base64 (id:api_key), заменяет логин и пароль
+	APIKey string
+	// токен сервисного аккаунта, заменяет логин и пароль
+	ServiceToken string
+	// PEM сертификат CA, пусто - системные корневые сертификаты
+	Cert []byte
+	// файл с PEM сертификатами CA, добавляется к Cert
+	CAFile string
+	// SHA256 отпечаток сертификата в hex, который эластик печатает при
+	// первом запуске. Вместо проверки цепочки сертификат сверяется с ним
+	CertificateFingerprint string
+	// клиентский сертификат и ключ для mutual TLS
+	ClientCertFile string
+	ClientKeyFile  string
+	// не проверять сертификат эластика, только для разработки
+	InsecureSkipVerify bool
 }
 
+var (
+	ErrInvalidCert         = errors.New("no PEM certificates found in elasticsearch CA")
+	ErrFingerprintMismatch = errors.New("elasticsearch certificate does not match configured fingerprint")
+)
+
 func NewClient(cfg *Config) (*elasticsearch.Client, error) {
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure elasticsearch TLS: %w", err)
 	}
 
 	transport := &http.Transport{
 		TLSClientConfig: tlsConfig,
 	}
 	es, err := elasticsearch.NewClient(elasticsearch.Config{
-		Addresses: []string{cfg.Address},
-		Username:  cfg.Username,
-		Password:  cfg.Password,
-		Transport: transport,
+		Addresses:    []string{cfg.Address},
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		APIKey:       cfg.APIKey,
+		ServiceToken: cfg.ServiceToken,
+		Transport:    propagatingTransport{transport},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create elasticsearch client: %v", err)
 	}
 	return es, nil
 }
+
+// propagatingTransport передает эластику traceparent из контекста запроса,
+// чтобы его медленные запросы можно было найти по трейсу сервиса
+type propagatingTransport struct {
+	base http.RoundTripper
+}
+
+func (t propagatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrip не должен менять исходный запрос
+	req = req.Clone(req.Context())
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return t.base.RoundTrip(req)
+}
+
+func newTLSConfig(cfg *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	ca := slices.Clone(cfg.Cert)
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		ca = append(append(ca, '\n'), data...)
+	}
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, ErrInvalidCert
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertificateFingerprint != "" {
+		fingerprint, err := parseFingerprint(cfg.CertificateFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		host, err := addressHost(cfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		// стандартная проверка цепочки отключается, вместо нее сертификат
+		// сверяется с отпечатком
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPinned(cs.PeerCertificates, fingerprint, host)
+		}
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// verifyPinned проверяет цепочку сервера по отпечатку. Если это отпечаток
+// самого сертификата сервера, больше ничего не нужно. Обычно же это http_ca
+// эластика: он публичный, и его может приложить к своей цепочке кто угодно,
+// поэтому сертификат сервера должен быть подписан им и выдан на host
+func verifyPinned(certs []*x509.Certificate, fingerprint []byte, host string) error {
+	if len(certs) == 0 {
+		return ErrFingerprintMismatch
+	}
+	leaf := certs[0]
+	if sum := sha256.Sum256(leaf.Raw); bytes.Equal(sum[:], fingerprint) {
+		return nil
+	}
+	for _, cert := range certs[1:] {
+		if sum := sha256.Sum256(cert.Raw); !bytes.Equal(sum[:], fingerprint) || !cert.IsCA {
+			continue
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+		intermediates := x509.NewCertPool()
+		for _, c := range certs[1:] {
+			if c != cert {
+				intermediates.AddCert(c)
+			}
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       host,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrFingerprintMismatch, err)
+		}
+		return nil
+	}
+	return ErrFingerprintMismatch
+}
+
+// addressHost имя хоста или IP из адреса эластика, на него должен быть
+// выдан сертификат
+func addressHost(address string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid elasticsearch address %q", address)
+	}
+	return u.Hostname(), nil
+}
+
+// parseFingerprint принимает hex отпечаток как с двоеточиями, так и без
+func parseFingerprint(s string) ([]byte, error) {
+	fingerprint, err := hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, fmt.Errorf("certificate fingerprint must be a SHA256 hex digest, got %q", s)
+	}
+	return fingerprint, nil
+}
+
+// IsTLSError ошибка проверки сертификата эластика. Такую ошибку нет смысла
+// повторять, ее нужно исправлять в настройках
+func IsTLSError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return errors.Is(err, ErrFingerprintMismatch) ||
+		errors.As(err, &verifyErr) ||
+		errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &invalid)
+}
@@ -0,0 +1,113 @@
+package elasticsearch
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newCert(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if !isCA {
+		tmpl.DNSNames = []string{name}
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func fingerprintOf(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.Raw)
+	return sum[:]
+}
+
+func TestVerifyPinned(t *testing.T) {
+	ca, caKey := newCert(t, "http_ca", true, nil, nil)
+	leaf, _ := newCert(t, "es.local", false, ca, caKey)
+	// сертификат атакующего, подписанный его собственным CA
+	evilCA, evilKey := newCert(t, "evil_ca", true, nil, nil)
+	evil, _ := newCert(t, "es.local", false, evilCA, evilKey)
+
+	tests := []struct {
+		name        string
+		chain       []*x509.Certificate
+		fingerprint []byte
+		host        string
+		wantErr     bool
+	}{
+		{"leaf pinned", []*x509.Certificate{leaf, ca}, fingerprintOf(leaf), "es.local", false},
+		{"leaf pinned other host", []*x509.Certificate{leaf}, fingerprintOf(leaf), "other", false},
+		{"ca pinned", []*x509.Certificate{leaf, ca}, fingerprintOf(ca), "es.local", false},
+		{"ca pinned wrong host", []*x509.Certificate{leaf, ca}, fingerprintOf(ca), "other", true},
+		{"ca appended to foreign chain", []*x509.Certificate{evil, ca}, fingerprintOf(ca), "es.local", true},
+		{"ca appended after foreign ca", []*x509.Certificate{evil, evilCA, ca}, fingerprintOf(ca), "es.local", true},
+		{"no match", []*x509.Certificate{leaf, ca}, fingerprintOf(evilCA), "es.local", true},
+		{"empty chain", nil, fingerprintOf(ca), "es.local", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyPinned(tt.chain, tt.fingerprint, tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyPinned() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrFingerprintMismatch) {
+				t.Fatalf("verifyPinned() error = %v, want ErrFingerprintMismatch", err)
+			}
+		})
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	hexSum := "a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+	colons := ""
+	for i := 0; i < len(hexSum); i += 2 {
+		if i > 0 {
+			colons += ":"
+		}
+		colons += hexSum[i : i+2]
+	}
+	tests := []struct {
+		in      string
+		wantErr bool
+	}{
+		{hexSum, false},
+		{colons, false},
+		{hexSum[:62], true},
+		{"not hex", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseFingerprint(tt.in); (err != nil) != tt.wantErr {
+			t.Errorf("parseFingerprint(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const countryCode = "7"
+
+var (
+	ErrNoDigits      = errors.New("phone has no digits")
+	ErrInvalidLength = errors.New("phone has invalid number of digits")
+	ErrInvalidCode   = errors.New("phone has invalid area code")
+)
+
+// Number телефон в формате E.164 вместе с исходным текстом, из которого
+// он был разобран
+type Number struct {
+	E164      string `json:"e164"`
+	Extension string `json:"extension,omitempty"`
+	Raw       string `json:"raw"`
+}
+
+// маркеры добавочного номера, все что после них уходит в Extension
+var extensionMarkers = []string{"доб.", "доб", "ext.", "ext", "вн.", "#", "x"}
+
+// Parse разбирает один российский номер: "(499) 183-14-10", "8 499 183 14 10",
+// "+7 (499) 183-14-10 доб. 12" и т.п.
+func Parse(raw string) (Number, error) {
+	s := strings.TrimSpace(raw)
+	main, ext := splitExtension(s)
+
+	digits := onlyDigits(main)
+	if digits == "" {
+		return Number{}, ErrNoDigits
+	}
+
+	switch {
+	case len(digits) == 11 && (digits[0] == '7' || digits[0] == '8'):
+		digits = digits[1:]
+	case len(digits) != 10:
+		return Number{}, fmt.Errorf("%w: %q", ErrInvalidLength, raw)
+	}
+
+	// национальные номера РФ начинаются на 3, 4, 8 или 9
+	if !strings.ContainsRune("3489", rune(digits[0])) {
+		return Number{}, fmt.Errorf("%w: %q", ErrInvalidCode, raw)
+	}
+
+	return Number{
+		E164:      "+" + countryCode + digits,
+		Extension: onlyDigits(ext),
+		Raw:       s,
+	}, nil
+}
+
+// ParseList разбирает ячейку с несколькими номерами, разделенными ';' или ','.
+// Фрагменты без цифр (например "нет телефона") пропускаются молча, остальные
+// неразобранные фрагменты возвращаются в списке ошибок. Повторы одного и того
+// же номера с тем же добавочным остаются в списке один раз
+func ParseList(raw string) ([]Number, []error) {
+	numbers := make([]Number, 0, 1)
+	seen := make(map[Number]struct{}, 1)
+	var errs []error
+	for _, part := range strings.FieldsFunc(raw, func(r rune) bool { return r == ';' || r == ',' }) {
+		n, err := Parse(part)
+		if errors.Is(err, ErrNoDigits) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		key := Number{E164: n.E164, Extension: n.Extension}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		numbers = append(numbers, n)
+	}
+	return numbers, errs
+}
+
+func splitExtension(s string) (string, string) {
+	lower := strings.ToLower(s)
+	for _, marker := range extensionMarkers {
+		if i := strings.Index(lower, marker); i > 0 {
+			return s[:i], s[i+len(marker):]
+		}
+	}
+	return s, ""
+}
+
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package phone
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Number
+		wantErr error
+	}{
+		// ячейки из datasets/data.csv
+		{"(499) 183-14-10", Number{E164: "+74991831410", Raw: "(499) 183-14-10"}, nil},
+		{"(985) 065-81-61", Number{E164: "+79850658161", Raw: "(985) 065-81-61"}, nil},
+		// в датасете номера только в виде (xxx) xxx-xx-xx, ниже форматы
+		// других выгрузок и ручного ввода
+		{"8 499 183 14 10", Number{E164: "+74991831410", Raw: "8 499 183 14 10"}, nil},
+		{"+7 (495) 139-03-33 доб. 12", Number{E164: "+74951390333", Extension: "12", Raw: "+7 (495) 139-03-33 доб. 12"}, nil},
+		{"  (916) 689-88-89 ext 5 ", Number{E164: "+79166898889", Extension: "5", Raw: "(916) 689-88-89 ext 5"}, nil},
+		{"183-14-10", Number{}, ErrInvalidLength},
+		{"(199) 183-14-10", Number{}, ErrInvalidCode},
+		{"нет телефона", Number{}, ErrNoDigits},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.raw)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		raw      string
+		want     []string
+		wantErrs int
+	}{
+		// ячейки из datasets/data.csv
+		{"(499) 183-14-10", []string{"+74991831410"}, 0},
+		{"(985) 065-81-61;(985) 065-81-61", []string{"+79850658161"}, 0},
+		{"нет телефона;(980) 268-97-54", []string{"+79802689754"}, 0},
+		// форматы других выгрузок и ручного ввода
+		{"(495) 139-03-33, (916) 689-88-89", []string{"+74951390333", "+79166898889"}, 0},
+		{"(495) 139-03-33;8 (495) 139-03-33 доб. 1", []string{"+74951390333", "+74951390333"}, 0},
+		{"(495) 139-03;(916) 689-88-89", []string{"+79166898889"}, 1},
+		{"", []string{}, 0},
+	}
+	for _, tt := range tests {
+		numbers, errs := ParseList(tt.raw)
+		got := make([]string, 0, len(numbers))
+		for _, n := range numbers {
+			got = append(got, n.E164)
+		}
+		if !reflect.DeepEqual(got, tt.want) || len(errs) != tt.wantErrs {
+			t.Errorf("ParseList(%q) = %v, %d errors, want %v, %d errors", tt.raw, got, len(errs), tt.want, tt.wantErrs)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package places
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const earthRadiusMeters = 6371000
+
+// DedupConfig настройки поиска дубликатов при загрузке датасета
+type DedupConfig struct {
+	Enabled bool
+	// максимальное расстояние между точками, чтобы считать их кандидатами
+	RadiusMeters float64
+	// минимальная похожесть названий (0..1), ниже которой пара не рассматривается
+	MinSimilarity float64
+	// пары с похожестью не ниже порога склеиваются автоматически,
+	// остальные только попадают в файл на ревью. Склеенные заведения
+	// скрываются, поэтому вместе с AutoMerge нужен ReviewFile
+	AutoMerge          bool
+	AutoMergeThreshold float64
+	// файл в формате json lines с решениями по каждой паре, пусто - не писать
+	ReviewFile string
+}
+
+func DefaultDedupConfig() DedupConfig {
+	return DedupConfig{
+		Enabled:            true,
+		RadiusMeters:       50,
+		MinSimilarity:      0.6,
+		AutoMerge:          false,
+		AutoMergeThreshold: 0.9,
+	}
+}
+
+const (
+	DedupDecisionMerged = "merged"
+	DedupDecisionReview = "review"
+)
+
+// DedupCandidate пара похожих заведений и принятое по ней решение
+type DedupCandidate struct {
+	ID          int     `json:"id"`
+	DuplicateID int     `json:"duplicate_id"`
+	Name        string  `json:"name"`
+	DupName     string  `json:"duplicate_name"`
+	Distance    float64 `json:"distance_m"`
+	Similarity  float64 `json:"similarity"`
+	Decision    string  `json:"decision"`
+}
+
+type dedupPoint struct {
+	doc      map[string]interface{}
+	id       int
+	name     string
+	trigrams map[string]struct{}
+	lat, lon float64
+}
+
+type cellKey struct {
+	lat, lon int
+}
+
+// apply ищет пары дубликатов среди docs и помечает склеенные документы полями
+// suppressed и duplicate_of. В кластер попадают только заведения, попарно
+// похожие не ниже AutoMergeThreshold, цепочка A~B~C без A~C не склеивается.
+// Каноническим в кластере остается заведение с наименьшим ID
+func (cfg DedupConfig) apply(docs []map[string]interface{}, report *ImportReport) error {
+	if !cfg.Enabled || len(docs) == 0 {
+		return nil
+	}
+
+	cellDeg := cfg.RadiusMeters / (earthRadiusMeters * math.Pi / 180)
+	grid := make(map[cellKey][]int)
+	points := make([]dedupPoint, 0, len(docs))
+	for _, doc := range docs {
+		lat, lon, ok := docLocation(doc)
+		if quarantined, _ := doc["quarantined"].(bool); !ok || quarantined {
+			continue
+		}
+		name, _ := doc["name"].(string)
+		id, _ := doc["id"].(int)
+		p := dedupPoint{
+			doc:      doc,
+			id:       id,
+			name:     name,
+			trigrams: trigrams(normalizeName(name)),
+			lat:      lat,
+			lon:      lon,
+		}
+		key := cellKey{int(math.Floor(lat / cellDeg)), int(math.Floor(lon / cellDeg))}
+		grid[key] = append(grid[key], len(points))
+		points = append(points, p)
+	}
+
+	var candidates []DedupCandidate
+	// индексы пар кандидатов и их точек, которые можно склеить
+	type mergePair struct{ c, i, j int }
+	var merges []mergePair
+
+	for i, p := range points {
+		// градус долготы короче градуса широты, поэтому по долготе
+		// соседних ячеек нужно просмотреть больше
+		lonSpan := int(math.Ceil(1 / math.Cos(p.lat*math.Pi/180)))
+		base := cellKey{int(math.Floor(p.lat / cellDeg)), int(math.Floor(p.lon / cellDeg))}
+		for dlat := -1; dlat <= 1; dlat++ {
+			for dlon := -lonSpan; dlon <= lonSpan; dlon++ {
+				for _, j := range grid[cellKey{base.lat + dlat, base.lon + dlon}] {
+					if j <= i {
+						continue
+					}
+					q := points[j]
+					distance := haversine(p.lat, p.lon, q.lat, q.lon)
+					if distance > cfg.RadiusMeters {
+						continue
+					}
+					similarity := jaccard(p.trigrams, q.trigrams)
+					if similarity < cfg.MinSimilarity {
+						continue
+					}
+					c := DedupCandidate{
+						ID:          p.id,
+						DuplicateID: q.id,
+						Name:        p.name,
+						DupName:     q.name,
+						Distance:    math.Round(distance*10) / 10,
+						Similarity:  math.Round(similarity*1000) / 1000,
+						Decision:    DedupDecisionReview,
+					}
+					if cfg.AutoMerge && similarity >= cfg.AutoMergeThreshold {
+						merges = append(merges, mergePair{len(candidates), i, j})
+					}
+					candidates = append(candidates, c)
+				}
+			}
+		}
+	}
+
+	// самые похожие пары склеиваются первыми. Кластеры объединяются, только
+	// если каждая пара их заведений проходит порог, иначе пара уходит на ревью
+	sort.SliceStable(merges, func(a, b int) bool {
+		return candidates[merges[a].c].Similarity > candidates[merges[b].c].Similarity
+	})
+	cluster := make([]int, len(points))
+	members := make(map[int][]int)
+	for i := range points {
+		cluster[i] = i
+		members[i] = []int{i}
+	}
+	for _, m := range merges {
+		a, b := cluster[m.i], cluster[m.j]
+		if a != b && !cfg.canMerge(points, members[a], members[b]) {
+			continue
+		}
+		candidates[m.c].Decision = DedupDecisionMerged
+		if a == b {
+			continue
+		}
+		for _, k := range members[b] {
+			cluster[k] = a
+		}
+		members[a] = append(members[a], members[b]...)
+		delete(members, b)
+	}
+
+	canonical := make(map[int]int)
+	for root, ms := range members {
+		canonical[root] = ms[0]
+		for _, k := range ms {
+			if points[k].id < points[canonical[root]].id {
+				canonical[root] = k
+			}
+		}
+	}
+	suppressed := 0
+	for i, p := range points {
+		c := canonical[cluster[i]]
+		if c == i {
+			p.doc["suppressed"] = false
+			continue
+		}
+		p.doc["suppressed"] = true
+		p.doc["duplicate_of"] = points[c].id
+		suppressed++
+	}
+	report.addDedup(suppressed, len(candidates))
+
+	if cfg.ReviewFile == "" {
+		return nil
+	}
+	return writeDedupReview(cfg.ReviewFile, candidates)
+}
+
+func writeDedupReview(path string, candidates []DedupCandidate) error {
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Similarity > candidates[j].Similarity
+	})
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, c := range candidates {
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func docLocation(doc map[string]interface{}) (float64, float64, bool) {
+	loc, ok := doc["location"].(map[string]interface{})
+	if !ok {
+		return 0, 0, false
+	}
+	lat, okLat := loc["lat"].(float64)
+	lon, okLon := loc["lon"].(float64)
+	return lat, lon, okLat && okLon
+}
+
+// canMerge каждое заведение кластера a - дубликат каждого из кластера b
+func (cfg DedupConfig) canMerge(points []dedupPoint, a, b []int) bool {
+	for _, i := range a {
+		for _, j := range b {
+			p, q := points[i], points[j]
+			if haversine(p.lat, p.lon, q.lat, q.lon) > cfg.RadiusMeters ||
+				jaccard(p.trigrams, q.trigrams) < cfg.AutoMergeThreshold {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// haversine расстояние между точками в метрах
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+// normalizeName приводит название к нижнему регистру и убирает кавычки,
+// пунктуацию и лишние пробелы: «Кафе "Ромашка"» и кафе ромашка совпадут
+func normalizeName(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+func trigrams(s string) map[string]struct{} {
+	runes := []rune("  " + s + " ")
+	res := make(map[string]struct{}, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		res[string(runes[i:i+3])] = struct{}{}
+	}
+	return res
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	inter := 0
+	for t := range a {
+		if _, ok := b[t]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
@@ -0,0 +1,222 @@
+package places
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func dedupDoc(id int, name string, lat, lon float64) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       id,
+		"name":     name,
+		"location": map[string]interface{}{"lat": lat, "lon": lon},
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`Кафе "Ромашка"`, "кафе ромашка"},
+		{"  КАФЕ   «Ромашка»!  ", "кафе ромашка"},
+		{"Шоколадница-2", "шоколадница 2"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeName(tt.in); got != tt.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJaccardOfNames(t *testing.T) {
+	sim := func(a, b string) float64 {
+		return jaccard(trigrams(normalizeName(a)), trigrams(normalizeName(b)))
+	}
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{`Кафе "Ромашка"`, "кафе ромашка", 1, 1},
+		{"Шоколадница", "Шоколадница", 1, 1},
+		{"Кофе Хауз", "Кофе Хаус", 0.6, 0.9},
+		{"Шоколадница", "Макдоналдс", 0, 0.1},
+		{"", "", 1, 1},
+	}
+	for _, tt := range tests {
+		if got := sim(tt.a, tt.b); got < tt.min || got > tt.max {
+			t.Errorf("similarity(%q, %q) = %.3f, want in [%.2f, %.2f]", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestHaversine(t *testing.T) {
+	// градус широты около 111.2 км
+	if got := haversine(55, 37, 56, 37); math.Abs(got-111195) > 100 {
+		t.Errorf("haversine one degree of latitude = %.0f m", got)
+	}
+	if got := haversine(55.75, 37.61, 55.75, 37.61); got != 0 {
+		t.Errorf("haversine of the same point = %f", got)
+	}
+}
+
+func TestDedupApply(t *testing.T) {
+	cfg := DedupConfig{
+		Enabled:            true,
+		RadiusMeters:       50,
+		MinSimilarity:      0.3,
+		AutoMerge:          true,
+		AutoMergeThreshold: 0.6,
+	}
+	// около 11 м между соседними точками по широте
+	const step = 0.0001
+
+	tests := []struct {
+		name           string
+		cfg            DedupConfig
+		docs           []map[string]interface{}
+		wantSuppressed map[int]int // id -> duplicate_of
+	}{
+		{
+			name: "same name nearby",
+			cfg:  cfg,
+			docs: []map[string]interface{}{
+				dedupDoc(2, `Кафе "Ромашка"`, 55.75, 37.61),
+				dedupDoc(1, "кафе ромашка", 55.75+step, 37.61),
+			},
+			wantSuppressed: map[int]int{2: 1},
+		},
+		{
+			name: "same name too far",
+			cfg:  cfg,
+			docs: []map[string]interface{}{
+				dedupDoc(1, "Ромашка", 55.75, 37.61),
+				dedupDoc(2, "Ромашка", 55.76, 37.61),
+			},
+		},
+		{
+			name: "auto merge off",
+			cfg:  DedupConfig{Enabled: true, RadiusMeters: 50, MinSimilarity: 0.3, AutoMergeThreshold: 0.6},
+			docs: []map[string]interface{}{
+				dedupDoc(1, "Ромашка", 55.75, 37.61),
+				dedupDoc(2, "Ромашка", 55.75+step, 37.61),
+			},
+		},
+		{
+			// A~B и B~C, но A и C непохожи: склеивается только самая похожая пара
+			name: "chain is not merged",
+			cfg:  DedupConfig{Enabled: true, RadiusMeters: 50, MinSimilarity: 0.3, AutoMerge: true, AutoMergeThreshold: 0.4},
+			docs: []map[string]interface{}{
+				dedupDoc(1, "абвгде", 55.75, 37.61),
+				dedupDoc(2, "абвгдежзи", 55.75+step, 37.61),
+				dedupDoc(3, "гдежзи", 55.75+2*step, 37.61),
+			},
+			wantSuppressed: map[int]int{2: 1},
+		},
+		{
+			name: "quarantined is skipped",
+			cfg:  cfg,
+			docs: []map[string]interface{}{
+				dedupDoc(1, "Ромашка", 55.75, 37.61),
+				func() map[string]interface{} {
+					d := dedupDoc(2, "Ромашка", 55.75+step, 37.61)
+					d["quarantined"] = true
+					return d
+				}(),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.apply(tt.docs, &ImportReport{}); err != nil {
+				t.Fatal(err)
+			}
+			for _, doc := range tt.docs {
+				id := doc["id"].(int)
+				suppressed, _ := doc["suppressed"].(bool)
+				want, wantSuppressed := tt.wantSuppressed[id]
+				if suppressed != wantSuppressed {
+					t.Errorf("place %d suppressed = %v, want %v", id, suppressed, wantSuppressed)
+				}
+				if wantSuppressed && doc["duplicate_of"] != want {
+					t.Errorf("place %d duplicate_of = %v, want %d", id, doc["duplicate_of"], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupReviewFile(t *testing.T) {
+	const step = 0.0001
+	cfg := DedupConfig{
+		Enabled:            true,
+		RadiusMeters:       50,
+		MinSimilarity:      0.5,
+		AutoMerge:          true,
+		AutoMergeThreshold: 0.9,
+		ReviewFile:         filepath.Join(t.TempDir(), "review.jsonl"),
+	}
+	// id и названия из datasets/data.csv, а координаты сдвинуты: в датасете
+	// эти места в километрах друг от друга, здесь все, кроме последнего, в радиусе
+	docs := []map[string]interface{}{
+		dedupDoc(1023, "AKADEMIJa", 55.7595, 37.6130),
+		dedupDoc(6336, "Akademija", 55.7595+step, 37.6130),
+		dedupDoc(2, "Kafe «Akademija»", 55.7595, 37.6130+step),
+		dedupDoc(0, "SMETANA", 55.7595, 37.6130),
+		// то же название, но дальше радиуса
+		dedupDoc(4224, "AKADEMIJa", 55.7695, 37.6130),
+	}
+	report := NewImportReport()
+	if err := cfg.apply(docs, report); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(cfg.ReviewFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []DedupCandidate
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var c DedupCandidate
+		if err := dec.Decode(&c); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, c)
+	}
+	want := []struct {
+		id, dup  int
+		decision string
+		minSim   float64
+		maxSim   float64
+	}{
+		{1023, 6336, DedupDecisionMerged, 1, 1},
+		{1023, 2, DedupDecisionReview, 0.5, 0.9},
+		{6336, 2, DedupDecisionReview, 0.5, 0.9},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("review file has %d candidates, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		c := got[i]
+		pair := [2]int{c.ID, c.DuplicateID}
+		if pair != [2]int{w.id, w.dup} && pair != [2]int{w.dup, w.id} {
+			t.Errorf("candidate %d = %d/%d, want %d/%d", i, c.ID, c.DuplicateID, w.id, w.dup)
+			continue
+		}
+		if c.Decision != w.decision || c.Similarity < w.minSim || c.Similarity > w.maxSim {
+			t.Errorf("candidate %d/%d: decision %s, similarity %.3f, want %s in [%.2f, %.2f]",
+				c.ID, c.DuplicateID, c.Decision, c.Similarity, w.decision, w.minSim, w.maxSim)
+		}
+		if c.Distance > cfg.RadiusMeters {
+			t.Errorf("candidate %d/%d: distance %.1f m is beyond radius", c.ID, c.DuplicateID, c.Distance)
+		}
+	}
+	if stats := report.Stats(); stats.Suppressed != 1 || stats.DuplicateCandidates != 3 {
+		t.Errorf("report = %+v, want 1 suppressed of 3 candidates", stats)
+	}
+}
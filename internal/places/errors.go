@@ -0,0 +1,93 @@
+package places
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// виды ошибок стора, проверяются через errors.Is
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrUnavailable = errors.New("elasticsearch is unavailable")
+	ErrBadQuery    = errors.New("bad query")
+	ErrTimeout     = errors.New("elasticsearch request timed out")
+)
+
+// StoreError вызов эластика op не удался. Kind - ErrNotFound, ErrUnavailable
+// или ErrBadQuery, Status - код ответа эластика, 0 если ответа не было
+type StoreError struct {
+	Op     string
+	Kind   error
+	Status int
+	Reason string
+	Err    error
+}
+
+func (e *StoreError) Error() string {
+	msg := "elasticsearch " + e.Op
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" [%d]", e.Status)
+	}
+	switch {
+	case e.Reason != "":
+		msg += ": " + e.Reason
+	case e.Err != nil:
+		msg += ": " + e.Err.Error()
+	default:
+		msg += ": " + e.Kind.Error()
+	}
+	return msg
+}
+
+func (e *StoreError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// responseError ошибка по ответу эластика с кодом 4xx или 5xx
+func responseError(op string, res *esapi.Response) *StoreError {
+	e := &StoreError{Op: op, Kind: ErrUnavailable, Status: res.StatusCode, Reason: res.Status()}
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		e.Kind = ErrNotFound
+	case http.StatusBadRequest:
+		e.Kind = ErrBadQuery
+	}
+	var body struct {
+		Error struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	if json.NewDecoder(res.Body).Decode(&body) == nil && body.Error.Type != "" {
+		e.Reason = body.Error.Type + ": " + body.Error.Reason
+	}
+	return e
+}
+
+// TimeoutError вызов эластика op не уложился в дедлайн. RequestDeadline -
+// закончилось время всего запроса, иначе истек таймаут самого вызова
+type TimeoutError struct {
+	Op              string
+	Timeout         time.Duration
+	RequestDeadline bool
+	Err             error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.RequestDeadline {
+		return fmt.Sprintf("elasticsearch %s: request deadline exceeded", e.Op)
+	}
+	return fmt.Sprintf("elasticsearch %s timed out after %s", e.Op, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() []error {
+	return []error{ErrTimeout, e.Err}
+}
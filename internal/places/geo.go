@@ -0,0 +1,138 @@
+package places
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	// точки вне региона не загружаются и считаются ошибочными строками
+	OutsideActionReject = "reject"
+	// точки вне региона загружаются с пометкой quarantined и скрываются из выдачи
+	OutsideActionQuarantine = "quarantine"
+)
+
+// Point пара долгота/широта, порядок как в GeoJSON
+type Point [2]float64
+
+// Region многоугольник, в который должны попадать все заведения датасета
+type Region struct {
+	Name    string  `json:"name"`
+	Polygon []Point `json:"polygon"`
+}
+
+// GeoConfig настройки проверки координат при загрузке. Регион выбирается
+// для каждого датасета отдельно, DefaultRegion используется, если он не указан
+type GeoConfig struct {
+	Regions       map[string]Region
+	DefaultRegion string
+	OutsideAction string
+}
+
+// moscowOblast грубый контур Московской области вместе с Москвой,
+// с запасом в несколько километров по краям
+var moscowOblast = Region{
+	Name: "moscow_oblast",
+	Polygon: []Point{
+		{35.10, 55.75}, {35.40, 56.30}, {36.00, 56.65}, {37.20, 57.00},
+		{38.35, 56.80}, {39.05, 56.40}, {40.25, 55.80}, {40.05, 55.25},
+		{39.35, 54.85}, {38.70, 54.20}, {37.80, 54.30}, {36.95, 54.75},
+		{36.25, 55.00}, {35.45, 55.30},
+	},
+}
+
+func DefaultGeoConfig() GeoConfig {
+	return GeoConfig{
+		Regions:       map[string]Region{moscowOblast.Name: moscowOblast},
+		DefaultRegion: moscowOblast.Name,
+		OutsideAction: OutsideActionReject,
+	}
+}
+
+// LoadRegions добавляет регионы из json файла со списком объектов Region
+func (cfg *GeoConfig) LoadRegions(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var regions []Region
+	if err := json.Unmarshal(data, &regions); err != nil {
+		return fmt.Errorf("error parsing regions file: %w", err)
+	}
+	for _, r := range regions {
+		if r.Name == "" || len(r.Polygon) < 3 {
+			return fmt.Errorf("region %q must have a name and at least 3 points", r.Name)
+		}
+		cfg.Regions[r.Name] = r
+	}
+	return nil
+}
+
+func (cfg GeoConfig) region(name string) (Region, error) {
+	if name == "" {
+		name = cfg.DefaultRegion
+	}
+	if name == "" {
+		return Region{}, nil
+	}
+	r, ok := cfg.Regions[name]
+	if !ok {
+		return Region{}, fmt.Errorf("unknown region %q", name)
+	}
+	return r, nil
+}
+
+type geoVerdict int
+
+const (
+	geoOK geoVerdict = iota
+	geoSwapped
+	geoOutside
+)
+
+var errZeroCoordinates = errors.New("zero coordinates")
+
+// check проверяет координаты точки и при необходимости меняет местами
+// широту и долготу. Если регион не задан, проверяются только допустимые
+// диапазоны широты и долготы
+func (r Region) check(lat, lon float64) (geoVerdict, error) {
+	if lat == 0 && lon == 0 {
+		return geoOutside, errZeroCoordinates
+	}
+	if len(r.Polygon) == 0 {
+		switch {
+		case validLatLon(lat, lon):
+			return geoOK, nil
+		case validLatLon(lon, lat):
+			return geoSwapped, nil
+		}
+		return geoOutside, fmt.Errorf("coordinates out of range: lat %v lon %v", lat, lon)
+	}
+	switch {
+	case r.contains(lat, lon):
+		return geoOK, nil
+	case r.contains(lon, lat):
+		return geoSwapped, nil
+	}
+	return geoOutside, fmt.Errorf("point lat %v lon %v is outside of region %s", lat, lon, r.Name)
+}
+
+func validLatLon(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// contains проверка попадания точки в многоугольник методом трассировки луча
+func (r Region) contains(lat, lon float64) bool {
+	inside := false
+	n := len(r.Polygon)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		xi, yi := r.Polygon[i][0], r.Polygon[i][1]
+		xj, yj := r.Polygon[j][0], r.Polygon[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,134 @@
+package places
+
+import (
+	"sync"
+
+	"github.com/zkhrg/go_day03/internal/metrics"
+)
+
+// ImportConfig настройки обработки датасета перед загрузкой в индекс
+type ImportConfig struct {
+	Dedup DedupConfig
+	Geo   GeoConfig
+}
+
+func DefaultImportConfig() ImportConfig {
+	return ImportConfig{
+		Dedup: DefaultDedupConfig(),
+		Geo:   DefaultGeoConfig(),
+	}
+}
+
+// ImportOptions параметры конкретной загрузки
+type ImportOptions struct {
+	// имя региона из GeoConfig.Regions, пусто - регион по умолчанию
+	Region string
+}
+
+// maxReportErrors ограничивает количество сообщений об ошибках в отчете,
+// чтобы битый файл на десятки тысяч строк не раздувал память
+const maxReportErrors = 100
+
+// ImportReport собирает прогресс загрузки датасета. Методы безопасны
+// для вызова из нескольких горутин (батчи отправляются параллельно)
+type ImportReport struct {
+	mu       sync.Mutex
+	rowsRead int
+	indexed  int
+	failed   int
+	errors   []string
+
+	suppressed int
+	candidates int
+
+	swapped     int
+	outside     int
+	quarantined int
+}
+
+// ImportStats снимок состояния ImportReport для отдачи наружу
+type ImportStats struct {
+	RowsRead int      `json:"rows_read"`
+	Indexed  int      `json:"indexed"`
+	Failed   int      `json:"failed"`
+	Errors   []string `json:"errors,omitempty"`
+	// склеенные дубликаты, скрытые из выдачи
+	Suppressed int `json:"suppressed"`
+	// все найденные пары похожих заведений, включая ушедшие на ревью
+	DuplicateCandidates int `json:"duplicate_candidates"`
+	// строки с перепутанными широтой и долготой, исправленные при загрузке
+	Swapped int `json:"swapped"`
+	// точки вне региона датасета, включая отправленные на карантин
+	OutsideRegion int `json:"outside_region"`
+	Quarantined   int `json:"quarantined"`
+}
+
+func NewImportReport() *ImportReport {
+	return &ImportReport{}
+}
+
+func (r *ImportReport) addRead() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rowsRead++
+	metrics.AddImportRows(metrics.RowsRead, 1)
+}
+
+func (r *ImportReport) addIndexed(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.indexed += n
+	metrics.AddImportRows(metrics.RowsIndexed, n)
+}
+
+func (r *ImportReport) addFailed(n int, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed += n
+	metrics.AddImportRows(metrics.RowsRejected, n)
+	if reason != "" && len(r.errors) < maxReportErrors {
+		r.errors = append(r.errors, reason)
+	}
+}
+
+func (r *ImportReport) addDedup(suppressed, candidates int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.suppressed += suppressed
+	metrics.AddImportRows(metrics.RowsSuppressed, suppressed)
+	r.candidates += candidates
+}
+
+func (r *ImportReport) addSwapped() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.swapped++
+	metrics.AddImportRows(metrics.RowsSwapped, 1)
+}
+
+func (r *ImportReport) addOutside(quarantined bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outside++
+	if quarantined {
+		r.quarantined++
+		metrics.AddImportRows(metrics.RowsQuarantined, 1)
+	}
+}
+
+func (r *ImportReport) Stats() ImportStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return ImportStats{
+		RowsRead: r.rowsRead,
+		Indexed:  r.indexed,
+		Failed:   r.failed,
+		Errors:   append([]string(nil), r.errors...),
+
+		Suppressed:          r.suppressed,
+		DuplicateCandidates: r.candidates,
+		Swapped:             r.swapped,
+		OutsideRegion:       r.outside,
+		Quarantined:         r.quarantined,
+	}
+}
@@ -1,11 +1,18 @@
 package places
 
+import (
+	"github.com/zkhrg/go_day03/internal/pkg/address"
+	"github.com/zkhrg/go_day03/internal/pkg/phone"
+)
+
 type Place struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Address  string `json:"address"`
-	Phone    string `json:"phone"`
-	Location struct {
+	ID                int                `json:"id"`
+	Name              string             `json:"name"`
+	Address           string             `json:"address"`
+	AddressComponents address.Components `json:"address_components"`
+	Phone             string             `json:"phone"`
+	Phones            []phone.Number     `json:"phones"`
+	Location          struct {
 		Lat float64 `json:"lat"`
 		Lon float64 `json:"lon"`
 	} `json:"location"`
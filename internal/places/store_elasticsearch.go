@@ -5,15 +5,27 @@ import (
 	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/zkhrg/go_day03/internal/metrics"
+	"github.com/zkhrg/go_day03/internal/pkg/address"
+	"github.com/zkhrg/go_day03/internal/pkg/phone"
+	"github.com/zkhrg/go_day03/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type SearchResponse struct {
@@ -34,66 +46,185 @@ type CountResponse struct {
 type esstore struct {
 	esdriver  *elasticsearch.Client
 	indexName string
+	importCfg ImportConfig
+	timeouts  StoreTimeouts
 }
 
-func (ess *esstore) GetPlacesByPageParams(ctx context.Context, pageNumber int, pageSize int) ([]Place, error) {
+// StoreTimeouts сколько ждать ответа эластика на один вызов поверх
+// дедлайна запроса, 0 - только дедлайн запроса
+type StoreTimeouts struct {
+	// поиск, подсчет и проверка индекса
+	Query time.Duration
+	// загрузка одного батча датасета
+	Bulk time.Duration
+}
+
+func (ess *esstore) timeout(op string) time.Duration {
+	if op == metrics.OpBulk {
+		return ess.timeouts.Bulk
+	}
+	return ess.timeouts.Query
+}
+
+// withTimeout контекст вызова op: дедлайн ctx, но не дольше таймаута операции
+func (ess *esstore) withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	if d := ess.timeout(op); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// callError ошибка вызова op с контекстом callCtx, порожденным от ctx.
+// Вызов, прерванный дедлайном, дает TimeoutError, отменой запроса - ошибку
+// контекста, остальные считаются недоступностью эластика
+func (ess *esstore) callError(ctx, callCtx context.Context, op string, err error) error {
+	switch {
+	case errors.Is(callCtx.Err(), context.DeadlineExceeded):
+		return &TimeoutError{Op: op, Timeout: ess.timeout(op), RequestDeadline: ctx.Err() != nil, Err: err}
+	case callCtx.Err() != nil:
+		return fmt.Errorf("elasticsearch %s: %w", op, callCtx.Err())
+	default:
+		return &StoreError{Op: op, Kind: ErrUnavailable, Err: err}
+	}
+}
+
+// decodeResponse разбирает в v успешный ответ эластика на вызов op
+func (ess *esstore) decodeResponse(ctx, callCtx context.Context, op string, res *esapi.Response, v any) error {
+	if res.IsError() {
+		return responseError(op, res)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return ess.callError(ctx, callCtx, op, fmt.Errorf("cannot parse response: %w", err))
+	}
+	return nil
+}
+
+// encodeQuery тело запроса к эластику. Ошибка возможна только для значений,
+// которых нет в JSON, например NaN в координатах
+func encodeQuery(op string, query map[string]interface{}) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+		return nil, &StoreError{Op: op, Kind: ErrBadQuery, Err: err}
+	}
+	return &buf, nil
+}
+
+// visibleQuery отбрасывает заведения, склеенные с другими при дедупликации,
+// и заведения на карантине из-за подозрительных координат
+func visibleQuery() map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must_not": []map[string]interface{}{
+				{"term": map[string]interface{}{"suppressed": true}},
+				{"term": map[string]interface{}{"quarantined": true}},
+			},
+		},
+	}
+}
+
+// GetPlacesByPageParams читает страницу мест. recordsCount берется из
+// GetTotalRecords, который вызывающий уже сделал для проверки номера страницы
+func (ess *esstore) GetPlacesByPageParams(ctx context.Context, pageNumber int, pageSize int, recordsCount int) ([]Place, error) {
+	ctx, span := tracing.Start(ctx, "esstore.GetPlacesByPageParams",
+		attribute.Int("page", pageNumber), attribute.Int("page_size", pageSize))
+	defer span.End()
+
 	searchAfter := 0
 	var r SearchResponse
 	chunkSize := pageSize
-	recordsCount := ess.GetTotalRecords()
 	if recordsCount == 0 {
 		return nil, nil
 	}
 	chunkSize = correctChunkSize(chunkSize)
-	chunkPagesNumber := pageNumber/(chunkSize/pageSize) + 1
+	chunkPagesNumber := chunksForPage(pageSize, pageNumber, chunkSize)
+	// глубокая страница стоит chunks последовательных запросов к эластику
+	span.SetAttributes(attribute.Int("chunk_size", chunkSize), attribute.Int("chunks", chunkPagesNumber))
 
 	for i := 0; i < chunkPagesNumber; i++ {
-		searchBody := map[string]interface{}{
-			"search_after": []interface{}{searchAfter},
-			"size":         chunkSize,
-			"sort": []map[string]interface{}{
-				{"id": "asc"},
-			},
-			"track_total_hits": true,
-			"query": map[string]interface{}{
-				"match_all": map[string]interface{}{},
-			},
+		if err := ess.searchChunk(ctx, i, searchAfter, chunkSize, &r); err != nil {
+			return nil, err
 		}
-
-		var buf bytes.Buffer
-		if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
-			log.Fatalf("Error encoding query: %s", err)
-		}
-
-		res, err := ess.esdriver.Search(
-			ess.esdriver.Search.WithIndex(ess.indexName),
-			ess.esdriver.Search.WithBody(&buf),
-		)
-		if err != nil {
-			log.Fatalf("Error getting the response: %s", err)
-		}
-		defer res.Body.Close()
-
-		if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-			log.Fatalf("Error parsing the response body: %s", err)
+		if len(r.Hits.Hits) == 0 {
+			// мест стало меньше, чем насчитал count
 			return nil, nil
 		}
 		searchAfter = int(r.Hits.Hits[len(r.Hits.Hits)-1].Sort[0].(float64))
 	}
 	start, end := calcStartEndForPage(pageSize, pageNumber, chunkSize, recordsCount)
+	end = min(end, len(r.Hits.Hits))
+	if start >= end {
+		return nil, nil
+	}
 	return placesHitsToPlaces(r.Hits.Hits[start:end]), nil
 }
 
-func (ess *esstore) GetTotalRecords() int {
-	var rc CountResponse
-	res_count, _ := ess.esdriver.Count(
+// searchChunk читает в r очередную порцию из size мест после searchAfter
+func (ess *esstore) searchChunk(ctx context.Context, chunk, searchAfter, size int, r *SearchResponse) (err error) {
+	ctx, span := tracing.Start(ctx, "esstore.search_chunk",
+		attribute.Int("chunk", chunk), attribute.Int("search_after", searchAfter), attribute.Int("size", size))
+	defer func() { tracing.End(span, err) }()
+	callCtx, cancel := ess.withTimeout(ctx, metrics.OpSearch)
+	defer cancel()
+
+	buf, err := encodeQuery(metrics.OpSearch, map[string]interface{}{
+		"search_after": []interface{}{searchAfter},
+		"size":         size,
+		"sort": []map[string]interface{}{
+			{"id": "asc"},
+		},
+		"track_total_hits": true,
+		"query":            visibleQuery(),
+	})
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	res, err := ess.esdriver.Search(
+		ess.esdriver.Search.WithContext(callCtx),
+		ess.esdriver.Search.WithIndex(ess.indexName),
+		ess.esdriver.Search.WithBody(buf),
+	)
+	metrics.ObserveStore(metrics.OpSearch, start, err != nil || res.IsError())
+	if err != nil {
+		return ess.callError(ctx, callCtx, metrics.OpSearch, err)
+	}
+	defer res.Body.Close()
+
+	if err := ess.decodeResponse(ctx, callCtx, metrics.OpSearch, res, r); err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int("hits", len(r.Hits.Hits)))
+	return nil
+}
+
+func (ess *esstore) GetTotalRecords(ctx context.Context) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "esstore.GetTotalRecords")
+	defer func() { tracing.End(span, err) }()
+	callCtx, cancel := ess.withTimeout(ctx, metrics.OpCount)
+	defer cancel()
+
+	buf, err := encodeQuery(metrics.OpCount, map[string]interface{}{"query": visibleQuery()})
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	res_count, err := ess.esdriver.Count(
+		ess.esdriver.Count.WithContext(callCtx),
 		ess.esdriver.Count.WithIndex(ess.indexName),
+		ess.esdriver.Count.WithBody(buf),
 	)
-	if err := json.NewDecoder(res_count.Body).Decode(&rc); err != nil {
-		log.Fatalf("error parsing the response body count: %s", err)
-		return 0
+	metrics.ObserveStore(metrics.OpCount, start, err != nil || res_count.IsError())
+	if err != nil {
+		return 0, ess.callError(ctx, callCtx, metrics.OpCount, err)
 	}
-	return rc.Count
+	defer res_count.Body.Close()
+
+	var rc CountResponse
+	if err := ess.decodeResponse(ctx, callCtx, metrics.OpCount, res_count, &rc); err != nil {
+		return 0, err
+	}
+	return rc.Count, nil
 }
 
 func correctChunkSize(chunkSize int) int {
@@ -107,12 +238,21 @@ func correctChunkSize(chunkSize int) int {
 	return chunkSize
 }
 
+// chunksForPage сколько порций по chunkSize нужно прочитать, чтобы в
+// последней оказалось первое место страницы
+func chunksForPage(pageSize, pageNumber, chunkSize int) int {
+	return (pageNumber-1)*pageSize/chunkSize + 1
+}
+
+// calcStartEndForPage границы страницы внутри последней прочитанной порции
 func calcStartEndForPage(pageSize, pageNumber, chunkSize, recordsCount int) (int, int) {
-	start := (pageSize * (pageNumber - 1)) % chunkSize
+	offset := pageSize * (pageNumber - 1)
+	start := offset % chunkSize
 	end := start + pageSize
 
-	if end >= recordsCount%chunkSize {
-		end = (recordsCount % chunkSize) - 1
+	// последняя страница может быть неполной
+	if rest := recordsCount - (offset - start); end > rest {
+		end = rest
 	}
 	return start, end
 }
@@ -122,17 +262,26 @@ func placesHitsToPlaces(ph []PlacesHit) []Place {
 	for i, v := range ph {
 		res[i].Name = v.Source.Name
 		res[i].Phone = v.Source.Phone
+		res[i].Phones = v.Source.Phones
 		res[i].ID = v.Source.ID
 		res[i].Address = v.Source.Address
+		res[i].AddressComponents = v.Source.AddressComponents
 		res[i].Location.Lat = v.Source.Location.Lat
 		res[i].Location.Lon = v.Source.Location.Lon
 	}
 	return res
 }
 
-func (ess *esstore) GetNearestPlaces(lat, lon float64) ([]Place, error) {
+func (ess *esstore) GetNearestPlaces(ctx context.Context, lat, lon float64) (_ []Place, err error) {
+	ctx, span := tracing.Start(ctx, "esstore.GetNearestPlaces",
+		attribute.Float64("lat", lat), attribute.Float64("lon", lon))
+	defer func() { tracing.End(span, err) }()
+	callCtx, cancel := ess.withTimeout(ctx, metrics.OpSearch)
+	defer cancel()
+
 	searchBody := map[string]interface{}{
-		"size": 3,
+		"size":  3,
+		"query": visibleQuery(),
 		"sort": []map[string]interface{}{
 			{"_geo_distance": map[string]interface{}{
 				"location": map[string]interface{}{
@@ -147,34 +296,36 @@ func (ess *esstore) GetNearestPlaces(lat, lon float64) ([]Place, error) {
 			}},
 		},
 	}
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
-		log.Fatalf("Error encoding query: %s", err)
+	buf, err := encodeQuery(metrics.OpSearch, searchBody)
+	if err != nil {
 		return nil, err
 	}
 
+	start := time.Now()
 	res, err := ess.esdriver.Search(
+		ess.esdriver.Search.WithContext(callCtx),
 		ess.esdriver.Search.WithIndex(ess.indexName),
-		ess.esdriver.Search.WithBody(&buf),
+		ess.esdriver.Search.WithBody(buf),
 	)
+	metrics.ObserveStore(metrics.OpSearch, start, err != nil || res.IsError())
 	if err != nil {
-		log.Fatalf("Error getting the response: %s", err)
-		return nil, err
+		return nil, ess.callError(ctx, callCtx, metrics.OpSearch, err)
 	}
 	defer res.Body.Close()
 
 	var r SearchResponse
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		log.Fatalf("Error parsing the response body: %s", err)
+	if err := ess.decodeResponse(ctx, callCtx, metrics.OpSearch, res, &r); err != nil {
 		return nil, err
 	}
 	return placesHitsToPlaces(r.Hits.Hits), nil
 }
 
-func NewElasticsearchStore(esdriver *elasticsearch.Client, indexName string) *esstore {
+func NewElasticsearchStore(esdriver *elasticsearch.Client, indexName string, importCfg ImportConfig, timeouts StoreTimeouts) *esstore {
 	return &esstore{
 		indexName: indexName,
 		esdriver:  esdriver,
+		importCfg: importCfg,
+		timeouts:  timeouts,
 	}
 }
 
@@ -194,49 +345,173 @@ type IndexMappings struct {
 }
 
 type IndexMappingsProperties struct {
-	ID       map[string]string `json:"id"`
-	Name     map[string]string `json:"name"`
-	Address  map[string]string `json:"address"`
-	Phone    map[string]string `json:"phone"`
-	Location map[string]string `json:"location"`
+	ID                map[string]string `json:"id"`
+	Name              map[string]string `json:"name"`
+	Address           map[string]string `json:"address"`
+	AddressComponents map[string]any    `json:"address_components"`
+	Phone             map[string]string `json:"phone"`
+	Phones            map[string]any    `json:"phones"`
+	Location          map[string]string `json:"location"`
 }
 
 const batchSize = 500
 
-func (ess *esstore) CreatePlacesIndex() {
-	indexBody := strings.NewReader(`{
-	  "settings": {
-	    "number_of_shards": 5
-	  },
-	  "mappings": {
+// bulkWorkers сколько bulk запросов одной загрузки идут в эластик параллельно
+const bulkWorkers = 4
+
+// placesMappings схема индекса мест. При старте она же накатывается на
+// существующий индекс: новые поля добавляются, а несовместимое изменение
+// старого поля требует пересоздать индекс
+const placesMappings = `{
+	"properties": {
+		"id": {
+			"type": "unsigned_long"
+		},
+		"name": {
+			"type": "text"
+		},
+		"address": {
+			"type": "text"
+		},
+		"address_components": {
 			"properties": {
-				"id": {
-					"type": "unsigned_long"
+				"city": {
+					"type": "keyword"
 				},
-				"name": {
-					"type": "text"
+				"street_type": {
+					"type": "keyword"
 				},
-				"address": {
-					"type": "text"
+				"street_name": {
+					"type": "keyword",
+					"fields": {
+						"text": {
+							"type": "text"
+						}
+					}
 				},
-				"phone": {
-					"type": "text"
+				"house": {
+					"type": "keyword"
+				},
+				"building": {
+					"type": "keyword"
 				},
-				"location": {
-					"type": "geo_point"
+				"structure": {
+					"type": "keyword"
+				},
+				"extra": {
+					"type": "keyword"
+				},
+				"malformed": {
+					"type": "boolean"
 				}
 			}
-  	}
+		},
+		"phone": {
+			"type": "text"
+		},
+		"phones": {
+			"properties": {
+				"e164": {
+					"type": "keyword"
+				},
+				"extension": {
+					"type": "keyword"
+				},
+				"raw": {
+					"type": "text"
+				}
+			}
+		},
+		"location": {
+			"type": "geo_point"
+		},
+		"suppressed": {
+			"type": "boolean"
+		},
+		"duplicate_of": {
+			"type": "unsigned_long"
+		},
+		"quarantined": {
+			"type": "boolean"
+		}
+	}
+}`
+
+// CreatePlacesIndex создает индекс мест, если его еще нет, и обновляет схему
+// существующего. Пока эластик недоступен, попытки повторяются до отмены ctx
+func (ess *esstore) CreatePlacesIndex(ctx context.Context) error {
+	indexBody := strings.NewReader(`{
+	  "settings": {
+	    "number_of_shards": 5
+	  },
+	  "mappings": ` + placesMappings + `
 	}`)
 
-	ess.createIndex(indexBody)
+	return ess.createIndex(ctx, indexBody)
+}
+
+// Ping проверяет, что эластик отвечает и индекс мест существует
+func (ess *esstore) Ping(ctx context.Context) error {
+	callCtx, cancel := ess.withTimeout(ctx, "ping")
+	defer cancel()
+	res, err := ess.esdriver.Indices.Exists([]string{ess.indexName},
+		ess.esdriver.Indices.Exists.WithContext(callCtx))
+	if err != nil {
+		return ess.callError(ctx, callCtx, "ping", err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return &StoreError{Op: "ping", Kind: ErrNotFound, Status: res.StatusCode,
+			Reason: fmt.Sprintf("index %s does not exist", ess.indexName)}
+	case res.IsError():
+		return responseError("ping", res)
+	}
+	return nil
 }
 
 func (ess *esstore) DeletePlacesIndex() {
 	ess.deleteIndex(ess.indexName)
 }
 
-func (ess *esstore) IndexingPlaces() {
+// ErrNothingIndexed в датасете были строки, но ни одна не попала в индекс
+var ErrNothingIndexed = errors.New("no places were indexed")
+
+// IndexingPlaces загружает датасет из csv файла path. Отмена ctx прерывает
+// загрузку между батчами
+func (ess *esstore) IndexingPlaces(ctx context.Context, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open dataset: %w", err)
+	}
+	defer file.Close()
+
+	report := NewImportReport()
+	if err := ess.IndexPlaces(ctx, file, ImportOptions{}, report); err != nil {
+		return fmt.Errorf("cannot index places: %w", err)
+	}
+
+	stats := report.Stats()
+	slog.Info("data indexing completed", "path", path,
+		"read", stats.RowsRead, "indexed", stats.Indexed, "failed", stats.Failed,
+		"swapped", stats.Swapped, "outside_region", stats.OutsideRegion, "quarantined", stats.Quarantined)
+	if stats.Indexed == 0 && stats.Failed > 0 {
+		return fmt.Errorf("%w: %d of %d rows failed", ErrNothingIndexed, stats.Failed, stats.RowsRead)
+	}
+	return nil
+}
+
+// IndexPlaces читает датасет в формате tsv из r и загружает его в индекс.
+// Ошибка возвращается только если файл нельзя разобрать целиком, проблемы
+// с отдельными строками и батчами попадают в report
+func (ess *esstore) IndexPlaces(ctx context.Context, r io.Reader, opts ImportOptions, report *ImportReport) (err error) {
+	ctx, span := tracing.Start(ctx, "esstore.IndexPlaces")
+	defer func() { tracing.End(span, err) }()
+
+	region, err := ess.importCfg.Geo.region(opts.Region)
+	if err != nil {
+		return err
+	}
 
 	headerMap := map[string]string{
 		"Name":      "name",
@@ -246,86 +521,195 @@ func (ess *esstore) IndexingPlaces() {
 		"Latitude":  "location.lat",
 		"ID":        "id",
 	}
-	file, err := os.Open("./datasets/data.csv")
-	if err != nil {
-		log.Fatalf("error opening csv file: %s", err)
-	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
+	reader := csv.NewReader(r)
 	reader.Comma = '\t'
 
 	// Чтение заголовков
 	headers, err := reader.Read()
 	if err != nil {
-		log.Fatalf("error reading headers: %s", err)
+		return fmt.Errorf("error reading headers: %w", err)
+	}
+	if err := validateHeaders(headers, headerMap); err != nil {
+		return err
 	}
 
-	var wg sync.WaitGroup
-
-	var batch []map[string]interface{}
+	// дубликаты ищутся по всему файлу, поэтому сначала читаем его целиком
+	var docs []map[string]interface{}
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		report.addRead()
 		if err != nil {
-			if err.Error() != "EOF" {
-				log.Fatalf("error reading CSV file: %s", err)
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				report.addFailed(1, err.Error())
+				continue
 			}
-			break
+			return fmt.Errorf("error reading CSV file: %w", err)
 		}
 
-		doc := make(map[string]interface{})
-		for i, value := range record {
-			if i < len(headers) {
-				key := headerMap[headers[i]]
-				if key == "phone" && value != "" && !strings.HasPrefix(value, "+7") {
-					value = "+7" + value
-				}
-				if key == "id" {
-					num, _ := strconv.Atoi(value)
-					num += 1
-					doc[key] = num
-					continue
-				}
-				if strings.HasPrefix(key, "location.") {
-					if doc["location"] == nil {
-						doc["location"] = make(map[string]interface{})
-					}
-					locMap := doc["location"].(map[string]interface{})
-					locKey := strings.TrimPrefix(key, "location.")
-					valueFloat, _ := strconv.ParseFloat(value, 64)
-					locMap[locKey] = valueFloat
-				} else {
-					doc[key] = value
-				}
-			}
+		doc, err := recordToDoc(headers, headerMap, record)
+		if err != nil {
+			report.addFailed(1, fmt.Sprintf("line %d: %s", lineOf(reader), err))
+			continue
 		}
 
-		batch = append(batch, doc)
-		if len(batch) >= batchSize {
-			wg.Add(1)
-			go func(batch []map[string]interface{}) {
-				defer wg.Done()
-				ess.sendBatch(batch)
-			}(batch)
-			batch = nil
+		if err := ess.checkLocation(doc, region, report); err != nil {
+			report.addFailed(1, fmt.Sprintf("line %d: %s", lineOf(reader), err))
+			continue
 		}
+
+		docs = append(docs, doc)
 	}
 
-	if len(batch) > 0 {
+	if err := ess.importCfg.Dedup.apply(docs, report); err != nil {
+		slog.Error("cannot write dedup review file", "err", err)
+	}
+
+	// батчи отправляются не больше чем bulkWorkers за раз
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, bulkWorkers)
+	for start := 0; start < len(docs); start += batchSize {
+		sem <- struct{}{}
+		if err := ctx.Err(); err != nil {
+			wg.Wait()
+			return err
+		}
+		end := min(start+batchSize, len(docs))
 		wg.Add(1)
 		go func(batch []map[string]interface{}) {
 			defer wg.Done()
-			ess.sendBatch(batch)
-		}(batch)
+			defer func() { <-sem }()
+			ess.sendBatch(ctx, batch, report)
+		}(docs[start:end])
 	}
 
 	wg.Wait()
+	span.SetAttributes(attribute.Int("documents", len(docs)))
+	return nil
+}
 
-	fmt.Println("data indexing completed.")
+// checkLocation сверяет координаты документа с регионом датасета. Перепутанные
+// широта и долгота исправляются, точки вне региона отклоняются с ошибкой или
+// помечаются quarantined в зависимости от настроек
+func (ess *esstore) checkLocation(doc map[string]interface{}, region Region, report *ImportReport) error {
+	loc := doc["location"].(map[string]interface{})
+	lat, lon := loc["lat"].(float64), loc["lon"].(float64)
+
+	verdict, err := region.check(lat, lon)
+	switch verdict {
+	case geoSwapped:
+		loc["lat"], loc["lon"] = lon, lat
+		report.addSwapped()
+	case geoOutside:
+		if ess.importCfg.Geo.OutsideAction != OutsideActionQuarantine {
+			report.addOutside(false)
+			return err
+		}
+		doc["quarantined"] = true
+		report.addOutside(true)
+	}
+	return nil
 }
 
-func (ess *esstore) sendBatch(batch []map[string]interface{}) {
+func validateHeaders(headers []string, headerMap map[string]string) error {
+	present := make(map[string]bool, len(headers))
+	for _, h := range headers {
+		present[h] = true
+	}
+	var missing []string
+	for h := range headerMap {
+		if !present[h] {
+			missing = append(missing, h)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing required columns: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func lineOf(reader *csv.Reader) int {
+	line, _ := reader.FieldPos(0)
+	return line
+}
+
+func recordToDoc(headers []string, headerMap map[string]string, record []string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	for i, value := range record {
+		if i < len(headers) {
+			key := headerMap[headers[i]]
+			if key == "" {
+				continue
+			}
+			if key == "address" {
+				components, _ := address.Parse(value)
+				doc["address_components"] = components
+			}
+			if key == "phone" {
+				// сам текст сохраняем как есть, а разобранные номера кладем отдельно,
+				// нераспознанные фрагменты остаются только в исходном тексте
+				numbers, _ := phone.ParseList(value)
+				doc["phones"] = numbers
+			}
+			if key == "id" {
+				num, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid ID %q", value)
+				}
+				num += 1
+				doc[key] = num
+				continue
+			}
+			if strings.HasPrefix(key, "location.") {
+				if doc["location"] == nil {
+					doc["location"] = make(map[string]interface{})
+				}
+				locMap := doc["location"].(map[string]interface{})
+				locKey := strings.TrimPrefix(key, "location.")
+				valueFloat, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil || math.IsNaN(valueFloat) || math.IsInf(valueFloat, 0) {
+					return nil, fmt.Errorf("invalid %s %q", headers[i], value)
+				}
+				locMap[locKey] = valueFloat
+			} else {
+				doc[key] = value
+			}
+		}
+	}
+	if _, ok := doc["id"]; !ok {
+		return nil, errors.New("missing ID")
+	}
+	if _, _, ok := docLocation(doc); !ok {
+		return nil, errors.New("missing Longitude or Latitude")
+	}
+	return doc, nil
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func (ess *esstore) sendBatch(ctx context.Context, batch []map[string]interface{}, report *ImportReport) {
+	ctx, span := tracing.Start(ctx, "esstore.bulk", attribute.Int("size", len(batch)))
+	defer span.End()
+
 	var buf strings.Builder
 	for _, doc := range batch {
 
@@ -340,56 +724,125 @@ func (ess *esstore) sendBatch(batch []map[string]interface{}) {
 		buf.WriteByte('\n')
 		buf.Write(data)
 		buf.WriteByte('\n')
-		fmt.Println(doc)
+		slog.Debug("indexing document", "id", doc["id"], "name", doc["name"])
 	}
 
+	start := time.Now()
+	// отмена загрузки не прерывает уже отправленный батч
+	callCtx, cancel := ess.withTimeout(context.WithoutCancel(ctx), metrics.OpBulk)
+	defer cancel()
 	res, err := ess.esdriver.Bulk(
 		strings.NewReader(buf.String()),
+		ess.esdriver.Bulk.WithContext(callCtx),
 		ess.esdriver.Bulk.WithIndex(ess.indexName),
 		ess.esdriver.Bulk.WithRefresh("true"),
 	)
+	metrics.ObserveStore(metrics.OpBulk, start, err != nil || res.IsError())
 	if err != nil {
-		log.Printf("error indexing batch: %s", err)
+		err = ess.callError(ctx, callCtx, metrics.OpBulk, err)
+		tracing.End(span, err)
+		slog.ErrorContext(ctx, "cannot index batch", "size", len(batch), "err", err)
+		report.addFailed(len(batch), fmt.Sprintf("error indexing batch: %s", err))
 		return
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		log.Printf("[%s] error indexing batch: %s", res.Status(), res.String())
+		span.SetStatus(codes.Error, res.Status())
+		slog.ErrorContext(ctx, "cannot index batch", "size", len(batch), "status", res.Status(), "response", res.String())
+		report.addFailed(len(batch), fmt.Sprintf("[%s] error indexing batch", res.Status()))
+		return
+	}
+
+	var br bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&br); err != nil {
+		tracing.End(span, err)
+		slog.ErrorContext(ctx, "cannot parse bulk response", "err", err)
+		report.addFailed(len(batch), fmt.Sprintf("error parsing bulk response: %s", err))
+		return
+	}
+	failed := 0
+	for _, item := range br.Items {
+		for _, result := range item {
+			if result.Error != nil {
+				failed++
+				report.addFailed(1, fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason))
+			}
+		}
+	}
+	report.addIndexed(len(br.Items) - failed)
+	span.SetAttributes(attribute.Int("failed", failed))
+	if failed > 0 {
+		slog.WarnContext(ctx, "batch indexed with failed documents", "size", len(batch), "failed", failed)
 	} else {
-		log.Printf("batch indexed successfully")
+		slog.DebugContext(ctx, "batch indexed", "size", len(batch))
 	}
 }
 
-// ТАК ДЕЛАТЬ НЕ НАДО НО МНЕ ОЧЕНЬ ЗАХОТЕЛОСБ
-func (ess *esstore) createIndex(index *strings.Reader) {
-	indexExists, err := ess.esdriver.Indices.Exists([]string{ess.indexName})
-	for err != nil {
-		log.Printf("Error checking if index exists: %s", err)
-		indexExists, err = ess.esdriver.Indices.Exists([]string{ess.indexName})
-		time.Sleep(5 * time.Second)
+// createIndexRetryInterval пауза между попытками проверить индекс
+const createIndexRetryInterval = 5 * time.Second
+
+func (ess *esstore) createIndex(ctx context.Context, index *strings.Reader) error {
+	var indexExists *esapi.Response
+	for {
+		var err error
+		indexExists, err = ess.esdriver.Indices.Exists([]string{ess.indexName},
+			ess.esdriver.Indices.Exists.WithContext(ctx))
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		slog.Error("cannot check if index exists, retrying", "index", ess.indexName, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(createIndexRetryInterval):
+		}
 	}
 	defer indexExists.Body.Close()
 
-	if indexExists.StatusCode == 200 {
-		fmt.Println("Index already exists")
-		return
+	if indexExists.StatusCode == http.StatusOK {
+		slog.Info("index already exists, updating mappings", "index", ess.indexName)
+		ess.updateMappings(ctx)
+		return nil
 	}
 
-	createIndexResponse, err := ess.esdriver.Indices.Create(
+	res, err := ess.esdriver.Indices.Create(
 		ess.indexName,
 		ess.esdriver.Indices.Create.WithBody(index),
+		ess.esdriver.Indices.Create.WithContext(ctx),
 	)
 	if err != nil {
-		log.Fatalf("Error creating index: %s", err)
+		return &StoreError{Op: "create_index", Kind: ErrUnavailable, Err: err}
 	}
-	defer createIndexResponse.Body.Close()
+	defer res.Body.Close()
+	if res.IsError() {
+		return responseError("create_index", res)
+	}
+	slog.Info("index created", "index", ess.indexName)
+	return nil
+}
 
-	if createIndexResponse.IsError() {
-		log.Printf("Error: %s", createIndexResponse.String())
-	} else {
-		fmt.Println("Index created successfully")
+// updateMappings добавляет в существующий индекс поля, появившиеся в
+// placesMappings после его создания
+func (ess *esstore) updateMappings(ctx context.Context) {
+	res, err := ess.esdriver.Indices.PutMapping([]string{ess.indexName}, strings.NewReader(placesMappings),
+		ess.esdriver.Indices.PutMapping.WithContext(ctx))
+	if err != nil {
+		slog.Error("cannot update index mappings", "index", ess.indexName, "err", err)
+		return
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		// например phones.e164 уже создан динамически как text: такое поле
+		// не поменять, индекс нужно удалить и загрузить заново
+		slog.Error("index mappings are incompatible, recreate the index", "index", ess.indexName,
+			"err", responseError("put_mapping", res))
+		return
 	}
+	slog.Info("index mappings updated", "index", ess.indexName)
 }
 
 func (ess *esstore) deleteIndex(indexName string) error {
@@ -0,0 +1,32 @@
+package places
+
+import "testing"
+
+func TestPageWindow(t *testing.T) {
+	tests := []struct {
+		name                    string
+		pageSize, page, records int
+		// сколько порций прочитать и границы страницы в последней из них
+		wantChunks, wantStart, wantEnd int
+	}{
+		{"first page", 10, 1, 25, 1, 0, 10},
+		{"last partial page", 10, 3, 25, 1, 20, 25},
+		// порция из 1000 мест заканчивается ровно на 100 странице
+		{"last page of chunk", 10, 100, 2000, 1, 990, 1000},
+		{"first page of next chunk", 10, 101, 2000, 2, 0, 10},
+		{"partial page of next chunk", 10, 101, 1005, 2, 0, 5},
+		// 7 не делит 700 нацело
+		{"page size not dividing chunk", 7, 100, 1000, 1, 693, 700},
+		{"page after uneven chunk", 7, 101, 1000, 2, 0, 7},
+		{"large page", 100, 10, 1000, 1, 900, 1000},
+	}
+	for _, tt := range tests {
+		chunkSize := correctChunkSize(tt.pageSize)
+		chunks := chunksForPage(tt.pageSize, tt.page, chunkSize)
+		start, end := calcStartEndForPage(tt.pageSize, tt.page, chunkSize, tt.records)
+		if chunks != tt.wantChunks || start != tt.wantStart || end != tt.wantEnd {
+			t.Errorf("%s: chunks %d, page [%d:%d], want %d, [%d:%d]",
+				tt.name, chunks, start, end, tt.wantChunks, tt.wantStart, tt.wantEnd)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Limit квота на одну метрику, 0 - без ограничения
+type Limit struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+// Plan тарифный план: квоты по метрикам, метрики без квоты не ограничены
+type Plan struct {
+	Name   string           `json:"-"`
+	Limits map[string]Limit `json:"limits"`
+}
+
+// Plans планы и их назначение клиентам. Subjects сопоставляет ключ
+// клиента (user:<логин> или key:<id API ключа>) с именем плана,
+// остальные получают DefaultPlan
+type Plans struct {
+	DefaultPlan string            `json:"default_plan"`
+	Plans       map[string]Plan   `json:"plans"`
+	Subjects    map[string]string `json:"subjects"`
+}
+
+// DefaultPlans один бесплатный план с дневной и месячной квотой на рекомендации
+func DefaultPlans() Plans {
+	return Plans{
+		DefaultPlan: "free",
+		Plans: map[string]Plan{
+			"free": {Limits: map[string]Limit{
+				"recommend": {Daily: 1000, Monthly: 20000},
+			}},
+		},
+	}
+}
+
+// LoadPlans читает планы из json файла
+func LoadPlans(path string) (Plans, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Plans{}, err
+	}
+	var p Plans
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Plans{}, err
+	}
+	return p, p.validate()
+}
+
+func (p Plans) validate() error {
+	if _, ok := p.Plans[p.DefaultPlan]; !ok {
+		return fmt.Errorf("default plan %q is not defined", p.DefaultPlan)
+	}
+	for subject, plan := range p.Subjects {
+		if _, ok := p.Plans[plan]; !ok {
+			return fmt.Errorf("plan %q of %s is not defined", plan, subject)
+		}
+	}
+	for name, plan := range p.Plans {
+		for metric, l := range plan.Limits {
+			if l.Daily < 0 || l.Monthly < 0 {
+				return fmt.Errorf("plan %q: negative quota for %s", name, metric)
+			}
+		}
+	}
+	return nil
+}
+
+// planFor план клиента
+func (p Plans) planFor(subject string) Plan {
+	name, ok := p.Subjects[subject]
+	if !ok {
+		name = p.DefaultPlan
+	}
+	plan := p.Plans[name]
+	plan.Name = name
+	return plan
+}
@@ -0,0 +1,139 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ExceededError какая квота исчерпана и когда она обновится
+type ExceededError struct {
+	Metric string
+	Period string
+	Reset  time.Time
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota for %s exceeded", e.Period, e.Metric)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// Store счетчики использования по клиенту, метрике и периоду (день
+// 2006-01-02 или месяц 2006-01). Реализация должна переживать перезапуск
+type Store interface {
+	// Incr увеличивает счетчики дня и месяца, если оба останутся в пределах
+	// лимитов (0 - без лимита), и возвращает значения после операции
+	Incr(ctx context.Context, subject, metric, day, month string, limit Limit) (daily, monthly int64, ok bool, err error)
+	// Decr отменяет одно увеличение Incr за те же день и месяц
+	Decr(ctx context.Context, subject, metric, day, month string) error
+	// Get текущие значения счетчиков
+	Get(ctx context.Context, subject, metric, day, month string) (daily, monthly int64, err error)
+}
+
+// Meter считает использование платных метрик и проверяет квоты планов
+type Meter struct {
+	store Store
+	plans Plans
+	now   func() time.Time
+}
+
+func NewMeter(store Store, plans Plans) (*Meter, error) {
+	if err := plans.validate(); err != nil {
+		return nil, err
+	}
+	return &Meter{store: store, plans: plans, now: time.Now}, nil
+}
+
+// Charge одно учтенное использование метрики. Периоды запоминаются, чтобы
+// возврат попал в те же день и месяц, даже если запрос шел через полночь
+type Charge struct {
+	subject, metric, day, month string
+}
+
+// Consume учитывает одно использование метрики. При исчерпанной квоте
+// возвращает *ExceededError и ничего не учитывает
+func (m *Meter) Consume(ctx context.Context, subject, metric string) (Charge, error) {
+	now := m.now().UTC()
+	limit := m.plans.planFor(subject).Limits[metric]
+	charge := Charge{subject: subject, metric: metric, day: now.Format(dayLayout), month: now.Format(monthLayout)}
+	_, monthly, ok, err := m.store.Incr(ctx, subject, metric, charge.day, charge.month, limit)
+	if err != nil {
+		return Charge{}, err
+	}
+	if ok {
+		return charge, nil
+	}
+	// при исчерпанных обеих квотах важен более поздний сброс месячной
+	if limit.Monthly > 0 && monthly >= limit.Monthly {
+		return Charge{}, &ExceededError{Metric: metric, Period: "monthly", Reset: nextMonth(now)}
+	}
+	return Charge{}, &ExceededError{Metric: metric, Period: "daily", Reset: nextDay(now)}
+}
+
+// Refund возвращает использование, за которое клиент не получил результат
+func (m *Meter) Refund(ctx context.Context, c Charge) error {
+	return m.store.Decr(ctx, c.subject, c.metric, c.day, c.month)
+}
+
+// PeriodUsage использование за период, Limit = 0 - без ограничения
+type PeriodUsage struct {
+	Used  int64     `json:"used"`
+	Limit int64     `json:"limit"`
+	Reset time.Time `json:"reset"`
+}
+
+type MetricUsage struct {
+	Daily   PeriodUsage `json:"daily"`
+	Monthly PeriodUsage `json:"monthly"`
+}
+
+// Usage использование клиента по всем метрикам его плана
+type Usage struct {
+	Plan    string                 `json:"plan"`
+	Metrics map[string]MetricUsage `json:"metrics"`
+}
+
+func (m *Meter) Usage(ctx context.Context, subject string) (Usage, error) {
+	now := m.now().UTC()
+	plan := m.plans.planFor(subject)
+	res := Usage{Plan: plan.Name, Metrics: make(map[string]MetricUsage)}
+	metrics := make([]string, 0, len(plan.Limits))
+	for metric := range plan.Limits {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	for _, metric := range metrics {
+		daily, monthly, err := m.store.Get(ctx, subject, metric, now.Format(dayLayout), now.Format(monthLayout))
+		if err != nil {
+			return Usage{}, err
+		}
+		limit := plan.Limits[metric]
+		res.Metrics[metric] = MetricUsage{
+			Daily:   PeriodUsage{Used: daily, Limit: limit.Daily, Reset: nextDay(now)},
+			Monthly: PeriodUsage{Used: monthly, Limit: limit.Monthly, Reset: nextMonth(now)},
+		}
+	}
+	return res, nil
+}
+
+func nextDay(t time.Time) time.Time {
+	y, mo, d := t.Date()
+	return time.Date(y, mo, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextMonth(t time.Time) time.Time {
+	y, mo, _ := t.Date()
+	return time.Date(y, mo+1, 1, 0, 0, 0, 0, time.UTC)
+}
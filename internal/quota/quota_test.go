@@ -0,0 +1,129 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestMeter(t *testing.T, limit Limit, now *time.Time) *Meter {
+	t.Helper()
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "usage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMeter(store, Plans{
+		DefaultPlan: "free",
+		Plans:       map[string]Plan{"free": {Limits: map[string]Limit{"recommend": limit}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func TestConsumeRollover(t *testing.T) {
+	ctx := context.Background()
+	var now time.Time
+	m := newTestMeter(t, Limit{Daily: 2, Monthly: 3}, &now)
+
+	steps := []struct {
+		at         time.Time
+		wantPeriod string // пусто - использование учтено
+		wantReset  time.Time
+	}{
+		{time.Date(2024, 1, 30, 10, 0, 0, 0, time.UTC), "", time.Time{}},
+		{time.Date(2024, 1, 30, 23, 59, 59, 0, time.UTC), "", time.Time{}},
+		{time.Date(2024, 1, 30, 23, 59, 59, 0, time.UTC), "daily", time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		// новый день, месячная квота почти исчерпана
+		{time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), "", time.Time{}},
+		{time.Date(2024, 1, 31, 1, 0, 0, 0, time.UTC), "monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// новый месяц обнуляет обе квоты
+		{time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), "", time.Time{}},
+		{time.Date(2024, 2, 1, 0, 0, 1, 0, time.UTC), "", time.Time{}},
+		{time.Date(2024, 2, 1, 0, 0, 2, 0, time.UTC), "daily", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		// периоды считаются в UTC: 02:30 по Москве 2 февраля это еще 1 февраля
+		{time.Date(2024, 2, 2, 2, 30, 0, 0, time.FixedZone("MSK", 3*3600)), "daily", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		// декабрь переходит в январь следующего года
+		{time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC), "", time.Time{}},
+		{time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC), "", time.Time{}},
+		{time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC), "daily", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for i, step := range steps {
+		now = step.at
+		_, err := m.Consume(ctx, "user:bob", "recommend")
+		if step.wantPeriod == "" {
+			if err != nil {
+				t.Errorf("step %d at %s: Consume() error = %v", i, step.at, err)
+			}
+			continue
+		}
+		var exceeded *ExceededError
+		if !errors.As(err, &exceeded) || !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("step %d at %s: Consume() error = %v, want %s quota exceeded", i, step.at, err, step.wantPeriod)
+			continue
+		}
+		if exceeded.Period != step.wantPeriod || !exceeded.Reset.Equal(step.wantReset) {
+			t.Errorf("step %d at %s: exceeded %s, reset %s, want %s, reset %s",
+				i, step.at, exceeded.Period, exceeded.Reset, step.wantPeriod, step.wantReset)
+		}
+	}
+}
+
+func TestRefund(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)
+	m := newTestMeter(t, Limit{Daily: 1}, &now)
+
+	charge, err := m.Consume(ctx, "user:bob", "recommend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ответ ушел уже в следующем дне, возврат должен попасть в день списания
+	now = now.Add(2 * time.Second)
+	if err := m.Refund(ctx, charge); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := m.Usage(ctx, "user:bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usage.Metrics["recommend"].Daily.Used; got != 0 {
+		t.Errorf("daily usage after refund = %d, want 0", got)
+	}
+	now = now.Add(-2 * time.Second)
+	if _, err := m.Consume(ctx, "user:bob", "recommend"); err != nil {
+		t.Errorf("Consume() after refund error = %v", err)
+	}
+	// повторный возврат не уводит счетчик в минус
+	for i := 0; i < 2; i++ {
+		if err := m.Refund(ctx, charge); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if usage, _ := m.Usage(ctx, "user:bob"); usage.Metrics["recommend"].Monthly.Used != 0 {
+		t.Errorf("monthly usage after double refund = %d, want 0", usage.Metrics["recommend"].Monthly.Used)
+	}
+}
+
+func TestPlansValidate(t *testing.T) {
+	free := map[string]Plan{"free": {Limits: map[string]Limit{"recommend": {Daily: 1}}}}
+	tests := []struct {
+		name    string
+		plans   Plans
+		wantErr bool
+	}{
+		{"default plans", DefaultPlans(), false},
+		{"unknown default plan", Plans{DefaultPlan: "pro", Plans: free}, true},
+		{"unknown subject plan", Plans{DefaultPlan: "free", Plans: free, Subjects: map[string]string{"user:bob": "pro"}}, true},
+		{"negative quota", Plans{DefaultPlan: "free", Plans: map[string]Plan{"free": {Limits: map[string]Limit{"recommend": {Monthly: -1}}}}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.plans.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
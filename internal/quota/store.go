@@ -0,0 +1,127 @@
+package quota
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zkhrg/go_day03/internal/pkg/jsonfile"
+)
+
+// FileStore счетчики в памяти, которые периодически сбрасываются в json
+// файл через FlushEvery. При падении теряется не больше одного интервала
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	// клиент -> метрика -> период -> значение
+	counters map[string]map[string]map[string]int64
+	dirty    bool
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, counters: make(map[string]map[string]map[string]int64)}
+	if err := jsonfile.Load(path, &s.counters); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Incr(ctx context.Context, subject, metric, day, month string, limit Limit) (int64, int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	periods := s.periods(subject, metric)
+	daily, monthly := periods[day], periods[month]
+	if (limit.Daily > 0 && daily >= limit.Daily) || (limit.Monthly > 0 && monthly >= limit.Monthly) {
+		return daily, monthly, false, nil
+	}
+	periods[day]++
+	periods[month]++
+	s.dirty = true
+	return periods[day], periods[month], true, nil
+}
+
+func (s *FileStore) Decr(ctx context.Context, subject, metric, day, month string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	periods := s.periods(subject, metric)
+	for _, period := range []string{day, month} {
+		if periods[period] > 0 {
+			periods[period]--
+		}
+	}
+	s.dirty = true
+	return nil
+}
+
+func (s *FileStore) Get(ctx context.Context, subject, metric, day, month string) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	periods := s.counters[subject][metric]
+	return periods[day], periods[month], nil
+}
+
+func (s *FileStore) periods(subject, metric string) map[string]int64 {
+	metrics, ok := s.counters[subject]
+	if !ok {
+		metrics = make(map[string]map[string]int64)
+		s.counters[subject] = metrics
+	}
+	periods, ok := metrics[metric]
+	if !ok {
+		periods = make(map[string]int64)
+		metrics[metric] = periods
+	}
+	return periods
+}
+
+// FlushEvery сохраняет счетчики раз в interval и при отмене ctx
+func (s *FileStore) FlushEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.flush()
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+func (s *FileStore) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return
+	}
+	s.prune(time.Now().UTC())
+	if err := jsonfile.Save(s.path, s.counters); err != nil {
+		slog.Error("cannot save quota usage", "err", err)
+		return
+	}
+	s.dirty = false
+}
+
+// prune удаляет периоды старше прошлого месяца, дни и месяцы сравниваются
+// как строки, их формат сортируется так же как даты
+func (s *FileStore) prune(now time.Time) {
+	y, mo, _ := now.Date()
+	cutoff := time.Date(y, mo-1, 1, 0, 0, 0, 0, time.UTC).Format(monthLayout)
+	for subject, metrics := range s.counters {
+		for metric, periods := range metrics {
+			for period := range periods {
+				if period[:len(monthLayout)] < cutoff {
+					delete(periods, period)
+				}
+			}
+			if len(periods) == 0 {
+				delete(metrics, metric)
+			}
+		}
+		if len(metrics) == 0 {
+			delete(s.counters, subject)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("rate limit must look like 10/s or 100/m:200")
+
+// Limit token bucket: Rate токенов в секунду, не больше Burst в запасе
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit разбирает лимит вида "<n>/<s|m|h>[:burst]", без burst он
+// равен n, то есть за период можно сделать n запросов подряд
+func ParseLimit(s string) (Limit, error) {
+	spec, burstStr, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	countStr, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, s)
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, s)
+	}
+	var period time.Duration
+	switch unit {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, s)
+	}
+	l := Limit{Rate: float64(count) / period.Seconds(), Burst: count}
+	if hasBurst {
+		burst, err := strconv.Atoi(burstStr)
+		if err != nil || burst <= 0 {
+			return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, s)
+		}
+		l.Burst = burst
+	}
+	return l, nil
+}
+
+// Result итог попытки взять токен
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// через сколько появится следующий токен, если запрос отклонен
+	RetryAfter time.Duration
+	// через сколько бакет снова будет полным
+	Reset time.Duration
+}
+
+// Store состояние бакетов. В памяти по умолчанию, для нескольких реплик
+// можно подключить общее хранилище с той же семантикой
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Config лимиты по именам маршрутов
+type Config struct {
+	Routes map[string]Limit
+	// брать адрес клиента из X-Forwarded-For, только за доверенным прокси
+	TrustForwardedFor bool
+}
+
+// Limiter лимиты по именам маршрутов поверх Store
+type Limiter struct {
+	store Store
+	cfg   Config
+}
+
+func NewLimiter(store Store, cfg Config) *Limiter {
+	return &Limiter{store: store, cfg: cfg}
+}
+
+func (l *Limiter) TrustForwardedFor() bool {
+	return l.cfg.TrustForwardedFor
+}
+
+// Allow тратит токен из бакета key на маршруте route. Для маршрута без
+// лимита ok = false и запрос не ограничивается
+func (l *Limiter) Allow(ctx context.Context, route, key string) (res Result, limit Limit, ok bool, err error) {
+	limit, ok = l.cfg.Routes[route]
+	if !ok {
+		return Result{}, Limit{}, false, nil
+	}
+	res, err = l.store.Take(ctx, route+"|"+key, limit, time.Now())
+	return res, limit, true, err
+}
+
+// take логика token bucket, общая для хранилищ: tokens и last - состояние
+// бакета, возвращается новое состояние и результат
+func take(tokens float64, last time.Time, limit Limit, now time.Time) (float64, Result) {
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+	}
+	res := Result{}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	res.Remaining = int(tokens)
+	res.Reset = seconds((float64(limit.Burst) - tokens) / limit.Rate)
+	return tokens, res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
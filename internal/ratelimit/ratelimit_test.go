@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"10/s", Limit{Rate: 10, Burst: 10}, false},
+		{"60/m", Limit{Rate: 1, Burst: 60}, false},
+		{"3600/h:10", Limit{Rate: 1, Burst: 10}, false},
+		{" 120/m:5 ", Limit{Rate: 2, Burst: 5}, false},
+		{"10", Limit{}, true},
+		{"10/d", Limit{}, true},
+		{"0/s", Limit{}, true},
+		{"-1/s", Limit{}, true},
+		{"10/s:0", Limit{}, true},
+		{"10/s:x", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("ParseLimit(%q) error = %v, want ErrInvalidLimit", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	// 1 токен в секунду, в запасе не больше 3
+	limit := Limit{Rate: 1, Burst: 3}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		after          time.Duration // от start
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+	}{
+		{0, true, 2, 0},
+		{0, true, 1, 0},
+		{0, true, 0, 0},
+		{0, false, 0, time.Second},
+		{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+		// за секунду набежал один токен
+		{time.Second, true, 0, 0},
+		{time.Second, false, 0, time.Second},
+		// долгий простой не дает больше Burst
+		{time.Hour, true, 2, 0},
+		{time.Hour, true, 1, 0},
+		{time.Hour, true, 0, 0},
+		{time.Hour, false, 0, time.Second},
+	}
+	store := NewMemoryStore()
+	for i, step := range steps {
+		res, err := store.Take(context.Background(), "user:bob", limit, start.Add(step.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != step.wantAllowed || res.Remaining != step.wantRemaining || res.RetryAfter != step.wantRetryAfter {
+			t.Errorf("step %d at +%s: got allowed=%v remaining=%d retry_after=%s, want %v %d %s",
+				i, step.after, res.Allowed, res.Remaining, res.RetryAfter, step.wantAllowed, step.wantRemaining, step.wantRetryAfter)
+		}
+	}
+
+	// у другого ключа свой бакет
+	res, err := store.Take(context.Background(), "user:alice", limit, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 2 {
+		t.Errorf("other key: got %+v, want allowed with 2 remaining", res)
+	}
+}
+
+func TestTakeReset(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 4}
+	now := time.Now()
+	tests := []struct {
+		name        string
+		tokens      float64
+		wantTokens  float64
+		wantAllowed bool
+		// через сколько бакет снова полон
+		wantReset time.Duration
+	}{
+		{"full bucket", 4, 3, true, 500 * time.Millisecond},
+		{"half bucket", 2, 1, true, 1500 * time.Millisecond},
+		{"empty bucket", 0, 0, false, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		tokens, res := take(tt.tokens, now, limit, now)
+		if tokens != tt.wantTokens || res.Allowed != tt.wantAllowed || res.Reset != tt.wantReset {
+			t.Errorf("%s: take() = %v tokens, allowed %v, reset %s, want %v, %v, %s",
+				tt.name, tokens, res.Allowed, res.Reset, tt.wantTokens, tt.wantAllowed, tt.wantReset)
+		}
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), Config{Routes: map[string]Limit{"login": {Rate: 1, Burst: 1}}})
+	steps := []struct {
+		route, key  string
+		wantLimited bool
+		wantAllowed bool
+	}{
+		// у маршрута без лимита запросы не считаются
+		{"places", "ip:1.2.3.4", false, false},
+		{"login", "ip:1.2.3.4", true, true},
+		{"login", "ip:1.2.3.4", true, false},
+		{"login", "ip:5.6.7.8", true, true},
+	}
+	for i, step := range steps {
+		res, _, limited, err := limiter.Allow(context.Background(), step.route, step.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if limited != step.wantLimited || res.Allowed != step.wantAllowed {
+			t.Errorf("step %d %s %s: limited %v, allowed %v, want %v, %v",
+				i, step.route, step.key, limited, res.Allowed, step.wantLimited, step.wantAllowed)
+		}
+	}
+}
@@ -1,8 +1,17 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -10,9 +19,15 @@ import (
 
 	myHttp "github.com/zkhrg/go_day03/cmd/server/http"
 	"github.com/zkhrg/go_day03/internal/api"
+	"github.com/zkhrg/go_day03/internal/auth"
 	"github.com/zkhrg/go_day03/internal/configs"
+	"github.com/zkhrg/go_day03/internal/metrics"
+	"github.com/zkhrg/go_day03/internal/pkg/certs"
 	"github.com/zkhrg/go_day03/internal/pkg/elasticsearch"
 	"github.com/zkhrg/go_day03/internal/places"
+	"github.com/zkhrg/go_day03/internal/quota"
+	"github.com/zkhrg/go_day03/internal/ratelimit"
+	"github.com/zkhrg/go_day03/internal/tracing"
 )
 
 // @securityDefinitions.apikey BearerAuth
@@ -20,30 +35,127 @@ import (
 // @name Authorization
 // @description Bearer token authentication. Type `Bearer <token>` to auth.
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key issued by an administrator at /admin/api-keys.
+
 func main() {
-	cfgs, err := configs.New()
-	if err != nil {
+	cfgs, err := configs.New(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
 		return
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%s\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(cfgs.Logger())
+
+	// SIGINT и SIGTERM отменяют ctx: сервер перестает принимать запросы,
+	// дожидается текущих и фоновые задачи сохраняют состояние
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+
+	shutdownTracing, err := tracing.Setup(ctx, cfgs.Tracing())
+	if err != nil {
+		fatal("cannot set up tracing", err)
+	}
 
+	// клиент только разбирает конфиг, до эластика он не ходит
 	es, err := elasticsearch.NewClient(cfgs.Elasticsearch())
-	for err != nil {
-		log.Printf("cannot create new es client retry after 5 sec\n")
-		time.Sleep(5 * time.Second)
-		es, err = elasticsearch.NewClient(cfgs.Elasticsearch())
-	}
-	ess := places.NewElasticsearchStore(es, cfgs.PlacesElasticsearchIndex())
-	ess.CreatePlacesIndex()
-	ess.IndexingPlaces()
-	placesAPI := api.NewStoreAPI(ess)
+	if err != nil {
+		fatal("invalid elasticsearch config", err)
+	}
+	importCfg, err := cfgs.Import()
+	if err != nil {
+		fatal("invalid import config", err)
+	}
+	ess := places.NewElasticsearchStore(es, cfgs.PlacesElasticsearchIndex(), importCfg, cfgs.StoreTimeouts())
+	users, err := auth.NewFileUserRepository(cfgs.UsersFile())
+	if err != nil {
+		fatal("cannot load users", err)
+	}
+	keys, err := auth.NewKeyStore(cfgs.JWTKeys())
+	if err != nil {
+		fatal("cannot load jwt keys", err)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go keys.ReloadOn(ctx, hup, cfgs.JWTKeysReloadInterval())
+
+	tokens, err := auth.NewTokens(keys, cfgs.JWT())
+	if err != nil {
+		fatal("invalid jwt config", err)
+	}
+
+	sessions := auth.NewSessions(tokens, cfgs.JWTRefreshTTL())
+
+	apiKeys, err := auth.NewAPIKeys(cfgs.APIKeysFile())
+	if err != nil {
+		fatal("cannot load api keys", err)
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		apiKeys.FlushEvery(ctx, time.Minute)
+	}()
+
+	oauth, err := auth.NewOAuth(tokens, sessions, cfgs.OAuthClientsFile())
+	if err != nil {
+		fatal("cannot load oauth clients", err)
+	}
+
+	limits, err := cfgs.RateLimits()
+	if err != nil {
+		fatal("invalid rate limit config", err)
+	}
+	limitStore, err := cfgs.RateLimitStore()
+	if err != nil {
+		fatal("invalid rate limit config", err)
+	}
+	limiter := ratelimit.NewLimiter(limitStore, limits)
+
+	plans, err := cfgs.QuotaPlans()
+	if err != nil {
+		fatal("invalid quota plans", err)
+	}
+	usage, err := quota.NewFileStore(cfgs.QuotaUsageFile())
+	if err != nil {
+		fatal("cannot load quota usage", err)
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		usage.FlushEvery(ctx, time.Minute)
+	}()
+	quotas, err := quota.NewMeter(usage, plans)
+	if err != nil {
+		fatal("invalid quota plans", err)
+	}
+
+	registry := auth.NewRegistry(users, cfgs.AdminUsers())
+	if err := registry.ProvisionAdmins(ctx, cfgs.AdminPasswordHash()); err != nil {
+		fatal("cannot create admin accounts", err)
+	}
+
+	placesAPI := api.NewStoreAPI(api.Options{
+		Store:          ess,
+		Users:          registry,
+		Tokens:         tokens,
+		Sessions:       sessions,
+		APIKeys:        apiKeys,
+		OAuth:          oauth,
+		Limiter:        limiter,
+		Quotas:         quotas,
+		PageSize:       cfgs.PageSize(),
+		RequestTimeout: cfgs.HTTP().RequestTimeout,
+		Config:         cfgs.Redacted(),
+	})
+	metrics.SetBuildInfo(cfgs.AppName, cfgs.AppVersion)
 	mainMux := http.NewServeMux()
 	myHttp.AddPlacesRoutes(placesAPI, mainMux)
 
-	// // handle not existsing pages after add all routes
-	// mainMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-	// 	http.NotFound(w, r)
-	// })
-
 	mainMux.Handle("/swagger/", httpSwagger.WrapHandler)
 
 	// Обработчик для Swagger JSON
@@ -51,8 +163,145 @@ func main() {
 		http.ServeFile(w, r, "./docs/swagger.json")
 	})
 
-	log.Println("Starting server on :8888")
-	if err := http.ListenAndServe(":8888", mainMux); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	httpCfg := cfgs.HTTP()
+	tlsCfg := cfgs.TLS()
+	var handler http.Handler = myHttp.RequestIDMiddleware(mainMux)
+	if tlsCfg.HSTSMaxAge > 0 {
+		handler = myHttp.HSTSMiddleware(tlsCfg.HSTSMaxAge, tlsCfg.HSTSIncludeSubdomains)(handler)
 	}
+	srv := &http.Server{
+		Addr:              httpCfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: httpCfg.ReadHeaderTimeout,
+		ReadTimeout:       httpCfg.ReadTimeout,
+		WriteTimeout:      httpCfg.WriteTimeout,
+		IdleTimeout:       httpCfg.IdleTimeout,
+	}
+	if tlsCfg.Enabled() {
+		reloader, err := newCertReloader(tlsCfg)
+		if err != nil {
+			fatal("cannot load tls certificate", err)
+		}
+		certHup := make(chan os.Signal, 1)
+		signal.Notify(certHup, syscall.SIGHUP)
+		go reloader.ReloadOn(ctx, certHup, tlsCfg.ReloadInterval)
+		// HTTP/2 включается сам, если сервер запущен через ServeTLS
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+	}
+
+	serverErr := make(chan error, 2)
+	go func() {
+		if srv.TLSConfig != nil {
+			slog.Info("starting HTTPS server", "addr", httpCfg.Addr)
+			serverErr <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		slog.Info("starting server", "addr", httpCfg.Addr)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	var redirectSrv *http.Server
+	if tlsCfg.RedirectAddr != "" {
+		redirectSrv = &http.Server{
+			Addr:              tlsCfg.RedirectAddr,
+			Handler:           myHttp.RedirectToHTTPSHandler(httpCfg.Addr),
+			ReadHeaderTimeout: httpCfg.ReadHeaderTimeout,
+			IdleTimeout:       httpCfg.IdleTimeout,
+		}
+		go func() {
+			slog.Info("redirecting HTTP to HTTPS", "addr", tlsCfg.RedirectAddr)
+			serverErr <- redirectSrv.ListenAndServe()
+		}()
+	}
+
+	// индекс загружается уже после старта сервера, до конца загрузки
+	// /readyz отвечает 503. При остановке дожидаемся отправленных батчей
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		const retryInterval = 5 * time.Second
+		for {
+			res, err := es.Ping(es.Ping.WithContext(ctx))
+			if err == nil {
+				res.Body.Close()
+				if !res.IsError() {
+					break
+				}
+				err = fmt.Errorf("ping status %s", res.Status())
+			}
+			// неверный сертификат не исправится сам, ждать бессмысленно
+			if elasticsearch.IsTLSError(err) {
+				fatal("elasticsearch TLS verification failed, check ES_CA_FILE, ES_CERT_CONTENT or ES_CERT_FINGERPRINT", err)
+			}
+			slog.Warn("elasticsearch is not reachable", "retry_after", retryInterval.String(), "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+		}
+		// без индекса или данных сервис остается неготовым, ошибка видна в логе
+		if err := ess.CreatePlacesIndex(ctx); err != nil {
+			if ctx.Err() == nil {
+				slog.Error("cannot create places index, service stays unready", "err", err)
+			}
+			return
+		}
+		if err := ess.IndexingPlaces(ctx, cfgs.PlacesDataset()); err != nil {
+			if ctx.Err() == nil {
+				slog.Error("cannot index dataset, service stays unready", "err", err)
+			}
+			return
+		}
+		if ctx.Err() == nil {
+			placesAPI.SetReady(true)
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("server failed", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, waiting for in-flight requests", "timeout", httpCfg.ShutdownTimeout.String())
+	placesAPI.SetReady(false)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), httpCfg.ShutdownTimeout)
+	defer cancel()
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server shutdown", "err", err)
+	}
+	// загрузка датасета через админку дописывает отправленные батчи
+	placesAPI.StopImports()
+	background.Wait()
+	// выгружаем спаны последних запросов
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("tracing shutdown", "err", err)
+	}
+	slog.Info("server stopped")
+}
+
+// newCertReloader сертификат HTTPS сервера из файлов или самоподписанный
+func newCertReloader(cfg configs.TLSSettings) (*certs.Reloader, error) {
+	if !cfg.SelfSigned {
+		return certs.NewReloader(cfg.CertFile, cfg.KeyFile)
+	}
+	cert, err := certs.SelfSigned()
+	if err != nil {
+		return nil, err
+	}
+	slog.Warn("using generated self-signed certificate, for development only")
+	return certs.Static(cert), nil
+}
+
+// fatal пишет ошибку запуска и завершает процесс
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }